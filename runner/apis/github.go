@@ -123,6 +123,7 @@ func GetGithubBranches(ctx context.Context, owner string, repo string) ([]Branch
 		req, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		req.Header.Set("Accept", "application/vnd.github+json")
@@ -132,11 +133,13 @@ func GetGithubBranches(ctx context.Context, owner string, repo string) ([]Branch
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		var branches []Branch
@@ -144,6 +147,7 @@ func GetGithubBranches(ctx context.Context, owner string, repo string) ([]Branch
 		err = json.Unmarshal(body, &branches)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		respChan <- Response{branches, nil}
@@ -174,6 +178,7 @@ func GetGithubLatestCommit(ctx context.Context, owner, repo string) (Commit, err
 		req, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		req.Header.Set("Accept", "application/vnd.github+json")
@@ -183,11 +188,13 @@ func GetGithubLatestCommit(ctx context.Context, owner, repo string) (Commit, err
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		var commits []Commit
@@ -195,10 +202,12 @@ func GetGithubLatestCommit(ctx context.Context, owner, repo string) (Commit, err
 		err = json.Unmarshal(body, &commits)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		if len(commits) == 0 {
 			respChan <- Response{error: fmt.Errorf("Failed to retrieve commits from https://api.github.com\n")}
+			return
 		}
 
 		respChan <- Response{commits[0], nil}
@@ -65,20 +65,24 @@ func GetYtbData(ctx context.Context, id string) (Snippet, error) {
 		res, err := http.Get(url)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		if res.StatusCode != http.StatusOK {
 			respChan <- Response{error: fmt.Errorf("Bad request, code:%d\n", res.StatusCode)}
+			return
 		}
 
 		var ytbResponse YtbResponse
 
 		if err = json.NewDecoder(res.Body).Decode(&ytbResponse); err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		if len(ytbResponse.Items) == 0 {
 			respChan <- Response{error: fmt.Errorf("Error retrieving video\n")}
+			return
 		}
 
 		ytbVidData := ytbResponse.Items[0].Snippet
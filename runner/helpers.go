@@ -2,15 +2,21 @@ package runner
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+
+	"github.com/leminhnguyenai/personal-blog/runner/lexer"
 )
 
 func HandleError(w http.ResponseWriter, err error) {
@@ -18,6 +24,52 @@ func HandleError(w http.ResponseWriter, err error) {
 	log.Printf("Error: %s\n", err.Error())
 }
 
+// Report the problems found while parsing the note, every problem is shown at once if
+// any of them is an error, otherwise they are logged and the note can be rendered
+func (e *Engine) handleDiagnostics(w http.ResponseWriter, file string, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	var diagnostics lexer.Diagnostics
+	if !errors.As(err, &diagnostics) {
+		HandleError(w, err)
+		return false
+	}
+
+	diagnostics = diagnostics.InFile(file)
+
+	if diagnostics.HasErrors() {
+		HandleError(w, diagnostics)
+		return false
+	}
+
+	for _, diagnostic := range diagnostics {
+		e.debug("%v\n", diagnostic)
+	}
+
+	return true
+}
+
+// Report the problems found while rendering the note, they stop the note from being
+// served unless in debug mode, where they are only logged
+func (e *Engine) handleRenderErrors(w http.ResponseWriter, file string, errs []error) bool {
+	if len(errs) == 0 {
+		return true
+	}
+
+	if !e.debugMode {
+		HandleError(w, fmt.Errorf("Rendering errors in %s:\n%v\n", file, errors.Join(errs...)))
+		return false
+	}
+
+	for _, err := range errs {
+		e.debug("Warning: %s: %v\n", file, err)
+	}
+
+	return true
+}
+
 // NOTE: This is a naive implementation of godotenv, it only support single line values currently
 func parseBytes(file *os.File) (map[string]string, error) {
 	scanner := bufio.NewScanner(file)
@@ -132,3 +184,142 @@ func FileServer(dirPath string) http.Handler {
 		http.ServeFile(w, r, filePath)
 	})
 }
+
+var supportedImageExt = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".bmp", ".ico"}
+
+// Read the attachment folder configured in the Obsidian vault, return an empty
+// string if the directory is not a vault or the setting is missing
+func attachmentFolder(rootDir string) string {
+	data, err := os.ReadFile(filepath.Join(rootDir, ".obsidian", "app.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		AttachmentFolderPath string `json:"attachmentFolderPath"`
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+
+	return config.AttachmentFolderPath
+}
+
+// Check if the path is located inside the directory
+func isWithinDir(dirPath string, filePath string) bool {
+	rel, err := filepath.Rel(dirPath, filePath)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Check if the file is inside the directory once symlinks are followed, a link inside
+// the directory can point anywhere
+func resolvesWithinDir(dirPath string, filePath string) bool {
+	realDir, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return false
+	}
+
+	realFile, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return false
+	}
+
+	return isWithinDir(realDir, realFile)
+}
+
+// Resolve the path of an asset referenced by a markdown file, the lookup order follows
+// Obsidian: relative to the file, inside the attachment folder, then anywhere in the vault.
+// Paths can lead to the parent directories, as long as they stay inside the root directory,
+// symlinks included
+func resolveAsset(rootDir string, mdDir string, assetPath string) (string, error) {
+	if !slices.Contains(supportedImageExt, strings.ToLower(path.Ext(assetPath))) {
+		return "", fmt.Errorf("Unsupported asset type %s\n", assetPath)
+	}
+
+	candidates := []string{filepath.Join(mdDir, filepath.FromSlash(assetPath))}
+
+	if folder := attachmentFolder(rootDir); folder != "" {
+		if strings.HasPrefix(folder, "./") || folder == "." {
+			candidates = append(candidates, filepath.Join(mdDir, folder, filepath.FromSlash(assetPath)))
+		} else {
+			candidates = append(candidates, filepath.Join(rootDir, folder, filepath.FromSlash(assetPath)))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if !isWithinDir(rootDir, candidate) || !resolvesWithinDir(rootDir, candidate) {
+			continue
+		}
+
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	// Obsidian's shortest path links only contain the filename
+	found := []string{}
+
+	filepath.WalkDir(rootDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && filePath != rootDir {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && entry.Name() == path.Base(assetPath) && resolvesWithinDir(rootDir, filePath) {
+			found = append(found, filePath)
+		}
+
+		return nil
+	})
+
+	if len(found) == 0 {
+		return "", fmt.Errorf("Asset not found: %s\n", assetPath)
+	}
+
+	// NOTE: The files are walked in lexical order, so the same one is always served
+	if len(found) > 1 {
+		log.Printf("Warning: %d files match the asset %s, serving %s over %s\n",
+			len(found), assetPath, found[0], strings.Join(found[1:], ", "))
+	}
+
+	return found[0], nil
+}
+
+// Serve the images referenced by a markdown file, rootDir is the content directory
+// and no file outside of it will be served
+func AssetServer(rootDir string, mdDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filePath, err := resolveAsset(rootDir, mdDir, r.PathValue("asset"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+
+		w.Header().Add("Cache-Control", "public, max-age=31536000")
+
+		// NOTE: http.ServeFile rejects requests with parent segments in the path, the asset is
+		// already resolved inside the root directory
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	})
+}
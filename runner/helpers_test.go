@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Create the files of the content directory inside a temporary directory, with a file outside of it.
+// Return the content directory
+func createAssets(t *testing.T) string {
+	base := t.TempDir()
+	rootDir := filepath.Join(base, "content")
+
+	for _, file := range []string{"outside.png", "content/top.png", "content/notes/local.png", "content/notes/secret.txt"} {
+		filePath := filepath.Join(base, filepath.FromSlash(file))
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filePath, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for link, target := range map[string]string{
+		"content/outside-link.png": "outside.png",
+		"content/inside-link.png":  "content/top.png",
+	} {
+		if err := os.Symlink(filepath.Join(base, target), filepath.Join(base, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks aren't supported: %v", err)
+		}
+	}
+
+	return rootDir
+}
+
+func TestResolveAsset(t *testing.T) {
+	rootDir := createAssets(t)
+	mdDir := filepath.Join(rootDir, "notes")
+
+	for assetPath, expected := range map[string]string{
+		"local.png":            "notes/local.png",
+		"../top.png":           "top.png",
+		"../notes/local.png":   "notes/local.png",
+		"../inside-link.png":   "inside-link.png",
+		"../../outside.png":    "",
+		"../outside-link.png":  "",
+		"outside-link.png":     "",
+		"secret.txt":           "",
+		"../notes/secret.txt":  "",
+		"../../content/top.pn": "",
+	} {
+		got, err := resolveAsset(rootDir, mdDir, assetPath)
+
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q: want an error, got %s", assetPath, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", assetPath, err)
+			continue
+		}
+
+		if want := filepath.Join(rootDir, filepath.FromSlash(expected)); got != want {
+			t.Errorf("%q: got %s, want %s", assetPath, got, want)
+		}
+	}
+}
+
+// Escaped slashes aren't cleaned from the path by the router, they are unescaped in the asset path
+func TestAssetServer(t *testing.T) {
+	rootDir := createAssets(t)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /note/{asset...}", AssetServer(rootDir, filepath.Join(rootDir, "notes")))
+
+	for url, status := range map[string]int{
+		"/note/local.png":                     http.StatusOK,
+		"/note/..%2Ftop.png":                  http.StatusOK,
+		"/note/..%2F..%2Foutside.png":         http.StatusNotFound,
+		"/note/%2E%2E%2F%2E%2E%2Foutside.png": http.StatusNotFound,
+		"/note/..%2Foutside-link.png":         http.StatusNotFound,
+		"/note/secret.txt":                    http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+
+		if recorder.Code != status {
+			t.Errorf("%s: got status %d, want %d", url, recorder.Code, status)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type Node struct {
 	Self     Token
@@ -18,7 +22,15 @@ func (node *Node) addChild(newNode *Node) {
 	node.Children = append(node.Children, newNode)
 }
 
+// Add the inline node as a value, nested inline elements are added to the
+// value containing them instead
 func (node *Node) addValue(newNode *Node) {
+	if len(node.Values) > 0 && newNode.isNestedIn(node.Values[len(node.Values)-1]) {
+		node.Values[len(node.Values)-1].addValue(newNode)
+		return
+	}
+
+	newNode.Parent = node
 	node.Values = append(node.Values, newNode)
 }
 
@@ -37,26 +49,56 @@ func (node *Node) indentationDiff(otherNode *Node) int {
 // If they are the same -> the 1st one is contained within a line
 // and the 2nd one is an inline element -> Both are on the same line
 func (node *Node) lineDiffStart(otherNode *Node) int {
-	return node.Self.Loc.start[0] - otherNode.Self.Loc.start[0]
+	return node.Self.Loc.Start.Line - otherNode.Self.Loc.Start.Line
 }
 
 func (node *Node) lineDiffEnd(otherNode *Node) int {
-	return node.Self.Loc.start[0] - otherNode.Self.Loc.end[0]
+	return node.Self.Loc.Start.Line - otherNode.Self.Loc.End.Line
+}
+
+// Check if the node is located within the other node in the source
+func (node *Node) isWithin(otherNode *Node) bool {
+	return node.Self.Loc.Start.Offset >= otherNode.Self.Loc.Start.Offset &&
+		node.Self.Loc.End.Offset <= otherNode.Self.Loc.End.Offset
 }
 
-// Check if the current node is a value of the other node
+// Check if the current node is a value of the other node, the content of paragraphs,
+// headings and list items can span multiple lines
 func (node *Node) isValueOf(otherNode *Node) bool {
-	return node.lineDiffStart(otherNode) == 0 &&
-		!otherNode.Self.isOneOfKinds(QUOTE) &&
+	return node.isWithin(otherNode) &&
+		!otherNode.Self.isOneOfKinds(QUOTE, TABLE, TABLE_ROW) &&
 		node.Self.isOneOfKinds(
 			TEXT,
 			LINK,
+			LINK_REF,
+			WIKILINK,
+			IMAGE,
+			FOOTNOTE_REF,
 			INLINE_CODE,
+			MATH_INLINE,
 			BOLD_TEXT,
 			ITALIC_TEXT,
+			STRIKETHROUGH,
+			HIGHLIGHT,
+			BLOCK_ID,
+			HARD_BREAK,
+			SHORTCODE,
 		)
 }
 
+// Check if the current inline node is located inside the other inline node
+// e.g. italic text inside bold text
+func (node *Node) isNestedIn(otherNode *Node) bool {
+	return otherNode.Self.isOneOfKinds(
+		LINK,
+		LINK_REF,
+		BOLD_TEXT,
+		ITALIC_TEXT,
+		STRIKETHROUGH,
+		HIGHLIGHT,
+	) && node.isWithin(otherNode)
+}
+
 func (node *Node) isChildOfHeading(otherNode *Node) bool {
 	return otherNode.Self.isOneOfKinds(
 		HEADING_1,
@@ -64,6 +106,7 @@ func (node *Node) isChildOfHeading(otherNode *Node) bool {
 		HEADING_3,
 		HEADING_4,
 		HEADING_5,
+		HEADING_6,
 	) && node.lineDiffStart(otherNode) > 0 &&
 		node.hasLowerPriority(otherNode)
 }
@@ -71,72 +114,392 @@ func (node *Node) isChildOfHeading(otherNode *Node) bool {
 func (node *Node) isChildOfIndentableToken(otherNode *Node) bool {
 	return otherNode.Self.isOneOfKinds(
 		HYPHEN_LIST,
+		TASK_LIST,
 		NUMBERED_LIST,
 		PARAGRAPH,
+		FOOTNOTE_DEF,
 	) && node.lineDiffStart(otherNode) > 0 &&
 		node.indentationDiff(otherNode) > 0
 }
 
+// The content of a quote is between its first and last line, to the right of the quote marker
 func (node *Node) isChildOfQuote(otherNode *Node) bool {
-	return otherNode.Self.isOneOfKinds(
-		QUOTE,
-		CALLOUT_NOTE,
-		CALLOUT_IMPORTANT,
-		CALLOUT_WARNING,
-		CALLOUT_EXAMPLE,
-	) &&
-		(node.lineDiffStart(otherNode) == 0 || node.lineDiffEnd(otherNode) == 0)
-}
-
-// Merge quotes if next to each other
-func (node *Node) isQuoteFragment(otherNode *Node) bool {
-	return node.Self.isOneOfKinds(QUOTE) &&
-		otherNode.Self.isOneOfKinds(
-			QUOTE,
-			CALLOUT_NOTE,
-			CALLOUT_IMPORTANT,
-			CALLOUT_WARNING,
-			CALLOUT_EXAMPLE,
-		) &&
-		(node.lineDiffStart(otherNode) == 1 || node.lineDiffEnd(otherNode) == 1) &&
-		node.indentationDiff(otherNode) == 0
+	return otherNode.Self.isOneOfKinds(QUOTE, CALLOUT) &&
+		node.lineDiffStart(otherNode) >= 0 &&
+		node.lineDiffEnd(otherNode) <= 0 &&
+		node.indentationDiff(otherNode) > 0
+}
+
+// Check if the node is inside a quote that is the other node or its latest descendant,
+// e.g. a heading inside a quote that is under a heading of the same level
+func (node *Node) isInsideQuote(otherNode *Node) bool {
+	if node.isChildOfQuote(otherNode) {
+		return true
+	}
+
+	if len(otherNode.Children) == 0 {
+		return false
+	}
+
+	return node.isInsideQuote(otherNode.Children[len(otherNode.Children)-1])
+}
+
+// Rows belong to the table spanning their line, cells and their values
+// belong to the row on the same line
+func (node *Node) isChildOfTable(otherNode *Node) bool {
+	return otherNode.Self.isOneOfKinds(TABLE) &&
+		node.lineDiffStart(otherNode) >= 0 &&
+		node.lineDiffEnd(otherNode) <= 0
+}
+
+func (node *Node) isChildOfTableRow(otherNode *Node) bool {
+	return otherNode.Self.isOneOfKinds(TABLE_ROW) &&
+		node.lineDiffStart(otherNode) == 0
 }
 
 // Find the closest ancestor of the Node using waterfall effect
-// The node can either be a value or a child of that ancestor
+// The node can either be a value or a child of that ancestor. Only the blocks still open,
+// the last child at each level, can contain the node, the earlier ones are never searched
 func (node *Node) findAncestor(possibleAncestor *Node) {
-	for i := len(possibleAncestor.Children) - 1; i >= 0; i-- {
-		// Comparison for value
-		if node.isValueOf(possibleAncestor.Children[i]) {
-			possibleAncestor.Children[i].addValue(node)
-			return
-		}
+	if len(possibleAncestor.Children) == 0 {
+		possibleAncestor.addChild(node)
+		return
+	}
+
+	lastChild := possibleAncestor.Children[len(possibleAncestor.Children)-1]
 
+	switch {
+	// Comparison for value
+	case node.isValueOf(lastChild):
+		lastChild.addValue(node)
+	// Comparison for quote, before headings as quotes can contain headings of any level
+	case node.isInsideQuote(lastChild),
 		// Comparision for Heading token
-		if node.isChildOfHeading(possibleAncestor.Children[i]) {
-			node.findAncestor(possibleAncestor.Children[i])
-			return
+		node.isChildOfHeading(lastChild),
+		// Comparison for table
+		node.isChildOfTable(lastChild),
+		node.isChildOfTableRow(lastChild),
+		// Comparison for Indentable token
+		node.isChildOfIndentableToken(lastChild):
+		node.findAncestor(lastChild)
+	default:
+		possibleAncestor.addChild(node)
+	}
+}
+
+func (node *Node) isListItem() bool {
+	return node.Self.isOneOfKinds(HYPHEN_LIST, TASK_LIST, NUMBERED_LIST)
+}
+
+// Get the marker of the list item, a different bullet or delimiter starts a new list
+// e.g. "-", "*", "+", "." or ")"
+func (node *Node) listMarker() string {
+	switch node.Self.Kind {
+	case TASK_LIST:
+		return node.Self.Values[1]
+	case NUMBERED_LIST:
+		marker := strings.TrimSpace(node.Self.Values[0])
+		return marker[len(marker)-1:]
+	default:
+		return strings.TrimSpace(node.Self.Values[0])
+	}
+}
+
+// Get the last line taken up by the node and its children
+func (node *Node) lastLine() int {
+	line := node.Self.Loc.End.Line
+
+	for _, child := range node.Children {
+		line = max(line, child.lastLine())
+	}
+
+	return line
+}
+
+// A list is loose if any of its items, or blocks inside an item, are separated by blank lines
+func isLooseList(items []*Node) bool {
+	for i, item := range items {
+		if i > 0 && item.Self.Loc.Start.Line-items[i-1].lastLine() > 1 {
+			return true
 		}
 
-		// Comparison for quote
-		if node.isQuoteFragment(possibleAncestor.Children[i]) {
-			possibleAncestor.Children[i].Self.Loc.end = node.Self.Loc.end
-			return
+		prevLine := item.Self.Loc.End.Line
+
+		for _, child := range item.Children {
+			if child.Self.Loc.Start.Line-prevLine > 1 {
+				return true
+			}
+
+			prevLine = child.lastLine()
 		}
+	}
 
-		if node.isChildOfQuote(possibleAncestor.Children[i]) {
-			node.findAncestor(possibleAncestor.Children[i])
-			return
+	return false
+}
+
+// Group adjacent list items with the same marker and indentation into LIST nodes
+// Values: type ("bullet" or "ordered"), start number of ordered lists, spacing ("tight" or "loose")
+func (node *Node) groupLists() {
+	children := []*Node{}
+
+	for i := 0; i < len(node.Children); {
+		first := node.Children[i]
+		first.groupLists()
+
+		if !first.isListItem() {
+			children = append(children, first)
+			i++
+			continue
 		}
 
-		// Comparison for Indentable token
-		if node.isChildOfIndentableToken(possibleAncestor.Children[i]) {
-			node.findAncestor(possibleAncestor.Children[i])
+		j := i + 1
+		for j < len(node.Children) && node.Children[j].isListItem() &&
+			node.Children[j].listMarker() == first.listMarker() &&
+			node.Children[j].indentationDiff(first) == 0 {
+			node.Children[j].groupLists()
+			j++
+		}
+
+		items := node.Children[i:j]
+
+		listType, start := "bullet", ""
+		if first.Self.Kind == NUMBERED_LIST {
+			number, _ := strconv.Atoi(strings.TrimRight(strings.TrimSpace(first.Self.Values[0]), ".)"))
+			listType, start = "ordered", strconv.Itoa(number)
+		}
+
+		spacing := "tight"
+		if isLooseList(items) {
+			spacing = "loose"
+		}
+
+		list := NewNode(NewToken(
+			LIST,
+			Location{Start: first.Self.Loc.Start, End: items[len(items)-1].Self.Loc.End},
+			listType, start, spacing,
+		))
+		list.Parent = node
+
+		for _, item := range items {
+			list.addChild(item)
+		}
+
+		children = append(children, list)
+		i = j
+	}
+
+	node.Children = children
+}
+
+func (node *Node) removeChild(child *Node) {
+	for i := range node.Children {
+		if node.Children[i] == child {
+			node.Children = append(node.Children[:i], node.Children[i+1:]...)
 			return
 		}
 	}
+}
+
+// Walk the tree in document order, including the inline values
+func (node *Node) walk(fn func(node *Node)) {
+	fn(node)
+
+	for _, value := range node.Values {
+		value.walk(fn)
+	}
+
+	for _, child := range node.Children {
+		child.walk(fn)
+	}
+}
+
+// Move the footnote definitions to a footnote section at the end of the document,
+// footnotes are numbered by the order of their first reference. Nothing is moved when
+// problems are found, so the definitions stay where they were written
+func collectFootnotes(root *Node, end Position) []Diagnostic {
+	definitions := map[string]*Node{}
+	references := []*Node{}
+	diagnostics := []Diagnostic{}
+
+	root.walk(func(node *Node) {
+		switch node.Self.Kind {
+		case FOOTNOTE_DEF:
+			label := node.Self.Values[0]
+			if _, ok := definitions[label]; ok {
+				diagnostics = append(diagnostics, newDiagnostic(
+					SEVERITY_ERROR, node.Self.Loc.Start.Offset, "duplicate footnote definition [^%s]", label,
+				))
+				return
+			}
+
+			definitions[label] = node
+		case FOOTNOTE_REF:
+			references = append(references, node)
+		}
+	})
+
+	if len(definitions) == 0 && len(references) == 0 {
+		return nil
+	}
+
+	// Labels in the order of their first reference
+	labels := []string{}
+	numbers := map[string]int{}
+
+	for _, ref := range references {
+		label := ref.Self.Values[0]
+
+		if _, ok := definitions[label]; !ok {
+			diagnostics = append(diagnostics, newDiagnostic(
+				SEVERITY_ERROR, ref.Self.Loc.Start.Offset, "unresolved footnote reference [^%s]", label,
+			))
+			continue
+		}
+
+		if _, ok := numbers[label]; !ok {
+			labels = append(labels, label)
+			numbers[label] = len(labels)
+		}
+	}
+
+	for label, definition := range definitions {
+		if _, ok := numbers[label]; !ok {
+			diagnostics = append(diagnostics, newDiagnostic(
+				SEVERITY_ERROR, definition.Self.Loc.Start.Offset, "unused footnote definition [^%s]", label,
+			))
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+
+	occurrences := map[string]int{}
+
+	for _, ref := range references {
+		label := ref.Self.Values[0]
+		occurrences[label]++
+
+		// Values: label, footnote number, occurrence of the reference
+		ref.Self.Values = []string{label, fmt.Sprint(numbers[label]), fmt.Sprint(occurrences[label])}
+	}
+
+	// The section takes up no space at the end of the document
+	footnotes := NewNode(NewToken(FOOTNOTES, Location{Start: end, End: end}))
+
+	for _, label := range labels {
+		definition := definitions[label]
+		definition.Parent.removeChild(definition)
+
+		// Values: label, footnote number, total references
+		definition.Self.Values = []string{label, fmt.Sprint(numbers[label]), fmt.Sprint(occurrences[label])}
+		footnotes.addChild(definition)
+	}
+
+	root.addChild(footnotes)
+
+	return nil
+}
+
+// Normalize the link label, labels are case-insensitive and whitespaces are collapsed
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// Merge adjacent text values, e.g. after an unresolved reference is turned back into text
+func (node *Node) mergeTextValues() {
+	merged := []*Node{}
+
+	for i := 0; i < len(node.Values); {
+		value := node.Values[i]
+
+		// Each run of text is joined at once, not by appending the values one by one
+		end := i + 1
+		for value.Self.Kind == TEXT && end < len(node.Values) && node.Values[end].Self.Kind == TEXT {
+			end++
+		}
+
+		if end-i > 1 {
+			texts := []string{}
+			for _, text := range node.Values[i:end] {
+				texts = append(texts, text.Self.Values[0])
+			}
+
+			value.Self.Values[0] = strings.Join(texts, "")
+			value.Self.Loc.End = node.Values[end-1].Self.Loc.End
+		}
+
+		merged = append(merged, value)
+		i = end
+	}
 
-	possibleAncestor.addChild(node)
+	node.Values = merged
+}
+
+// Replace the link references with ordinary links using the link definitions, the
+// definitions themselves are removed from the document
+func resolveLinkReferences(root *Node) []Diagnostic {
+	definitions := map[string]*Node{}
+	// Every definition, including the duplicates ignored when resolving
+	definitionNodes := []*Node{}
+	references := []*Node{}
+	diagnostics := []Diagnostic{}
+
+	root.walk(func(node *Node) {
+		switch node.Self.Kind {
+		case LINK_DEF:
+			definitionNodes = append(definitionNodes, node)
+
+			// The first definition takes precedence
+			if _, ok := definitions[normalizeLabel(node.Self.Values[0])]; !ok {
+				definitions[normalizeLabel(node.Self.Values[0])] = node
+			}
+		case LINK_REF:
+			references = append(references, node)
+		}
+	})
+
+	for _, definition := range definitionNodes {
+		definition.Parent.removeChild(definition)
+	}
+
+	// Elements holding references rendered as text, their text is merged once all are resolved
+	textParents := []*Node{}
+	merged := map[*Node]bool{}
+
+	for _, ref := range references {
+		placeholder, label, form, source := ref.Self.Values[0], ref.Self.Values[1], ref.Self.Values[2], ref.Self.Values[3]
+
+		definition, ok := definitions[normalizeLabel(label)]
+		if ok {
+			ref.Self.Kind = LINK
+			ref.Self.Values = []string{placeholder, definition.Self.Values[1], definition.Self.Values[2]}
+			continue
+		}
+
+		// A reference without definition is just text in brackets, e.g. matrix[0][1]. Only the
+		// full and collapsed forms are reported, shortcuts are mostly brackets in prose
+		if form != "shortcut" {
+			diagnostics = append(diagnostics, newDiagnostic(
+				SEVERITY_WARNING, ref.Self.Loc.Start.Offset, "undefined link reference [%s], rendered as text", label,
+			))
+		}
+
+		ref.Self.Kind = TEXT
+		ref.Self.Values = []string{source}
+		ref.Values = nil
+
+		if !merged[ref.Parent] {
+			merged[ref.Parent] = true
+			textParents = append(textParents, ref.Parent)
+		}
+	}
+
+	for _, parent := range textParents {
+		parent.mergeTextValues()
+	}
+
+	return diagnostics
 }
 
 func (node *Node) Display(str *string, level int) {
@@ -164,21 +527,58 @@ func (node *Node) Display(str *string, level int) {
 	}
 }
 
+// Build the tree of the document, the error is a list of every problem found as
+// Diagnostics, along with the tree built from the rest of the source
 func ParseAST(source string) (*Node, error) {
+	return parseAST(source, true)
+}
+
+// Build the tree of a note embedded in another one, the frontmatter is optional as notes
+// meant to be embedded usually have none
+func ParseEmbeddedAST(source string) (*Node, error) {
+	return parseAST(source, false)
+}
+
+func parseAST(source string, requireFrontmatter bool) (*Node, error) {
+	diagnostics := []Diagnostic{}
+
 	tokens, err := Tokenize(source)
 	if err != nil {
-		return nil, err
+		// Already located, they are located again along with the rest
+		diagnostics = append(diagnostics, err.(Diagnostics)...)
 	}
 
-	frontmatter := NewNode(tokens[0])
-	if frontmatter.Self.Kind != FRONTMATTER {
-		return nil, fmt.Errorf("No frontmatter found\n")
+	if len(tokens) == 0 || tokens[0].Kind != FRONTMATTER {
+		if requireFrontmatter {
+			diagnostics = append(diagnostics, newDiagnostic(SEVERITY_ERROR, 0, "no frontmatter found"))
+		}
+
+		// The rest of the document is still parsed to report its problems
+		tokens = append([]Token{NewToken(FRONTMATTER, Location{}, "")}, tokens...)
 	}
 
+	frontmatter := NewNode(tokens[0])
+	// Inline elements come right after the block containing them
+	block := frontmatter
+
 	// Each node will be organized after initialized immediately
 	for _, token := range tokens[1:] {
-		NewNode(token).findAncestor(frontmatter)
+		node := NewNode(token)
+
+		if node.isValueOf(block) {
+			block.addValue(node)
+			continue
+		}
+
+		node.findAncestor(frontmatter)
+		block = node
 	}
 
-	return frontmatter, nil
+	frontmatter.groupLists()
+
+	diagnostics = append(diagnostics, resolveLinkReferences(frontmatter)...)
+	end := newLineIndex(source, Position{}).position(len(source))
+	diagnostics = append(diagnostics, collectFootnotes(frontmatter, end)...)
+
+	return frontmatter, finalizeDiagnostics(diagnostics, source)
 }
@@ -0,0 +1,161 @@
+package lexer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	default:
+		return ""
+	}
+}
+
+// A problem found in the source, errors stop the note from being rendered while
+// warnings are only reported
+type Diagnostic struct {
+	Severity Severity
+	// Empty unless set by the caller, the lexer only knows the source
+	File string
+	// Starting from 1, the column is counted in runes
+	Line    int
+	Column  int
+	Message string
+	// The line of the source and a caret under the column
+	Snippet string
+
+	// Byte offset in the source, moved along with the tokens of quotes and to the
+	// document once located
+	offset int
+}
+
+func newDiagnostic(severity Severity, offset int, format string, args ...any) Diagnostic {
+	return Diagnostic{Severity: severity, Message: fmt.Sprintf(format, args...), offset: offset}
+}
+
+// Number of bytes of a long line shown on each side of the caret of a snippet
+const SNIPPET_CONTEXT = 60
+
+// Fill in the line, column and snippet from the source the offset refers to, the
+// offset is then moved from the source of the index to the document
+func (diagnostic *Diagnostic) locate(index lineIndex) {
+	offset := min(diagnostic.offset, len(index.source))
+	position := index.position(offset)
+	diagnostic.offset = position.Offset
+	diagnostic.Line = position.Line + 1
+	diagnostic.Column = position.Column + 1
+
+	line := position.Line - index.start.Line
+	lineStart, lineEnd := index.lineStarts[line], len(index.source)
+	if line+1 < len(index.lineStarts) {
+		lineEnd = index.lineStarts[line+1] - 1
+	}
+
+	// Long lines are cut around the caret, so a line with many problems isn't copied into each of them
+	from, to, prefix, suffix := lineStart, lineEnd, "", ""
+	if offset-from > SNIPPET_CONTEXT {
+		from, prefix = offset-SNIPPET_CONTEXT, "..."
+		for !utf8.RuneStart(index.source[from]) {
+			from++
+		}
+	}
+	if to-offset > SNIPPET_CONTEXT {
+		to, suffix = offset+SNIPPET_CONTEXT, "..."
+		for to < lineEnd && !utf8.RuneStart(index.source[to]) {
+			to++
+		}
+	}
+
+	// Tabs are kept so the caret lines up with the character above it
+	padding := strings.Map(func(char rune) rune {
+		if char == '\t' {
+			return char
+		}
+		return ' '
+	}, prefix+index.source[from:offset])
+
+	diagnostic.Snippet = prefix + strings.TrimSuffix(index.source[from:to], "\r") + suffix + "\n" + padding + "^"
+}
+
+func (diagnostic Diagnostic) Error() string {
+	str := fmt.Sprintf("%d:%d: %s: %s", diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Message)
+	if diagnostic.File != "" {
+		str = diagnostic.File + ":" + str
+	}
+
+	if diagnostic.Snippet != "" {
+		for _, line := range strings.Split(diagnostic.Snippet, "\n") {
+			str += "\n    | " + line
+		}
+	}
+
+	return str
+}
+
+// Every problem found in the source, in order of their location
+type Diagnostics []Diagnostic
+
+func (diagnostics Diagnostics) Error() string {
+	messages := make([]string, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		messages[i] = diagnostic.Error()
+	}
+
+	return strings.Join(messages, "\n\n")
+}
+
+// Check if any of the problems stops the note from being rendered
+func (diagnostics Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(diagnostics, func(diagnostic Diagnostic) bool {
+		return diagnostic.Severity == SEVERITY_ERROR
+	})
+}
+
+// Return a copy of the diagnostics reported for the file, the ones already reported
+// for another file, e.g. an embedded note, keep it
+func (diagnostics Diagnostics) InFile(file string) Diagnostics {
+	cpy := slices.Clone(diagnostics)
+	for i := range cpy {
+		if cpy[i].File == "" {
+			cpy[i].File = file
+		}
+	}
+
+	return cpy
+}
+
+// Locate the diagnostics in the source and sort them, nil if there are none so
+// the result can be returned as an error
+func finalizeDiagnostics(diagnostics []Diagnostic, source string) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	locateDiagnostics(diagnostics, newLineIndex(source, Position{}))
+
+	return Diagnostics(diagnostics)
+}
+
+func locateDiagnostics(diagnostics []Diagnostic, index lineIndex) {
+	for i := range diagnostics {
+		diagnostics[i].locate(index)
+	}
+
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		return a.offset - b.offset
+	})
+}
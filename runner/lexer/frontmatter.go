@@ -0,0 +1,186 @@
+package lexer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Groups: line, message
+var yamlErrorRegex = regexp.MustCompile(`^yaml: (?:line (\d+): )?(.*)$`)
+
+// Metadata of a note, written as YAML between the `---` lines at the start of the document
+type Frontmatter struct {
+	ID          string
+	Title       string
+	Description string
+	Author      string
+	Date        string
+	Updated     string
+	Draft       bool
+	Tags        []string
+	Aliases     []string
+	// The rest of the keys, with their values decoded as YAML
+	Extra map[string]any
+}
+
+// Parse the YAML between the delimiters of the frontmatter, the error is a list of
+// Diagnostics located in the content and the fields without problems are still returned
+func ParseFrontmatter(content string) (Frontmatter, error) {
+	frontmatter, diagnostics := parseFrontmatter(content)
+
+	return frontmatter, finalizeDiagnostics(diagnostics, content)
+}
+
+// The offsets of the diagnostics are in the content
+func parseFrontmatter(content string) (Frontmatter, []Diagnostic) {
+	frontmatter := Frontmatter{Extra: map[string]any{}}
+	diagnostics := []Diagnostic{}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		line, message := 1, err.Error()
+
+		if parts := yamlErrorRegex.FindStringSubmatch(message); parts != nil {
+			message = parts[2]
+			if parts[1] != "" {
+				line, _ = strconv.Atoi(parts[1])
+			}
+		}
+
+		diagnostics = append(diagnostics, newDiagnostic(
+			SEVERITY_ERROR, yamlOffset(content, line, 1), "invalid frontmatter, %s", message,
+		))
+
+		return frontmatter, diagnostics
+	}
+
+	// Frontmatter with nothing but comments
+	if len(document.Content) == 0 {
+		return frontmatter, diagnostics
+	}
+
+	mapping := document.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		diagnostics = append(diagnostics, newDiagnostic(
+			SEVERITY_ERROR, yamlOffset(content, mapping.Line, mapping.Column), "frontmatter must be a mapping of keys to values",
+		))
+
+		return frontmatter, diagnostics
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		var ok bool
+
+		switch key.Value {
+		case "id":
+			frontmatter.ID, ok = yamlString(value)
+		case "title":
+			frontmatter.Title, ok = yamlString(value)
+		case "description":
+			frontmatter.Description, ok = yamlString(value)
+		case "author":
+			frontmatter.Author, ok = yamlString(value)
+		case "date":
+			frontmatter.Date, ok = yamlString(value)
+		case "updated":
+			frontmatter.Updated, ok = yamlString(value)
+		case "draft":
+			ok = value.Decode(&frontmatter.Draft) == nil
+		case "tags":
+			frontmatter.Tags, ok = yamlStrings(value)
+		case "aliases":
+			frontmatter.Aliases, ok = yamlStrings(value)
+		default:
+			var extra any
+			if ok = value.Decode(&extra) == nil; ok {
+				frontmatter.Extra[key.Value] = extra
+			}
+		}
+
+		if !ok {
+			diagnostics = append(diagnostics, newDiagnostic(
+				SEVERITY_ERROR, yamlOffset(content, value.Line, value.Column),
+				"invalid value of %s, expected %s", key.Value, expectedValue(key.Value),
+			))
+		}
+	}
+
+	return frontmatter, diagnostics
+}
+
+// Describe the values accepted for the key
+func expectedValue(key string) string {
+	switch key {
+	case "draft":
+		return "true or false"
+	case "tags", "aliases":
+		return "a list of names"
+	case "id", "title", "description", "author", "date", "updated":
+		return "a single value"
+	default:
+		return "a valid YAML value"
+	}
+}
+
+// Dates and numbers are kept as written
+func yamlString(node *yaml.Node) (string, bool) {
+	if node.Kind != yaml.ScalarNode {
+		return "", false
+	}
+
+	return node.Value, true
+}
+
+// Lists can also be written as a single name
+func yamlStrings(node *yaml.Node) ([]string, bool) {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			return nil, true
+		}
+
+		return []string{node.Value}, true
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		return nil, false
+	}
+
+	values := []string{}
+	for _, item := range node.Content {
+		value, ok := yamlString(item)
+		if !ok {
+			return nil, false
+		}
+
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// Offset in the content of the line and column reported by the YAML parser, both start
+// from 1 and the column is counted in runes
+func yamlOffset(content string, line int, column int) int {
+	offset := 0
+
+	for i := 1; i < line; i++ {
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			return len(content)
+		}
+
+		offset += end + 1
+	}
+
+	for i := 1; i < column && offset < len(content) && content[offset] != '\n'; i++ {
+		_, size := utf8.DecodeRuneInString(content[offset:])
+		offset += size
+	}
+
+	return offset
+}
@@ -1,9 +1,13 @@
 package lexer
 
 import (
-	"fmt"
+	"html"
+	"iter"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -11,35 +15,147 @@ const (
 	CHAR                = `[^\n]`
 	NON_WHITESPACE_CHAR = `[^\s]`
 	INLINE_WHITESPACE   = `[^\S\t\r\n]`
+	// The characters matched by INLINE_WHITESPACE, for trimming without a pattern
+	INLINE_WHITESPACE_CHARS = " \f"
 
 	// Pattern for block elements
 	SKIP_NEWLINE_PATTERN = `\n+`
 
+	// Groups: underline
+	SETEXT_UNDERLINE_PATTERN = `^` + INLINE_WHITESPACE + `*` + `(=+|-+)` + INLINE_WHITESPACE + `*$`
+
+	HEADING_6_PATTERN = INLINE_WHITESPACE + `*` + `######` + INLINE_WHITESPACE
 	HEADING_5_PATTERN = INLINE_WHITESPACE + `*` + `#####` + INLINE_WHITESPACE
 	HEADING_4_PATTERN = INLINE_WHITESPACE + `*` + `####` + INLINE_WHITESPACE
 	HEADING_3_PATTERN = INLINE_WHITESPACE + `*` + `###` + INLINE_WHITESPACE
 	HEADING_2_PATTERN = INLINE_WHITESPACE + `*` + `##` + INLINE_WHITESPACE
 	HEADING_1_PATTERN = INLINE_WHITESPACE + `*` + `#` + INLINE_WHITESPACE
 
-	NUMBERED_LIST_PATTERN = INLINE_WHITESPACE + `*` + `\d+\.` + INLINE_WHITESPACE
-	HYPHEN_LIST_PATTERN   = INLINE_WHITESPACE + `*` + `-` + INLINE_WHITESPACE
+	NUMBERED_LIST_PATTERN = INLINE_WHITESPACE + `*` + `\d+[.)]` + INLINE_WHITESPACE
+	HYPHEN_LIST_PATTERN   = INLINE_WHITESPACE + `*` + `[-*+]` + INLINE_WHITESPACE
+	TASK_LIST_PATTERN     = HYPHEN_LIST_PATTERN + `\[[ xX]\]` + INLINE_WHITESPACE
+
+	HORIZONTAL_RULE_PATTERN = INLINE_WHITESPACE + `*` + `(-` + INLINE_WHITESPACE + `*){3,}` + `|` +
+		INLINE_WHITESPACE + `*` + `(\*` + INLINE_WHITESPACE + `*){3,}` + `|` +
+		INLINE_WHITESPACE + `*` + `(_` + INLINE_WHITESPACE + `*){3,}`
+
+	MATH_BLOCK_DELIMITER = `$$`
+
+	// Groups: label, destination and title
+	LINK_DEF_PATTERN = `^` + INLINE_WHITESPACE + `*` + `\[([^\n\[\]\^][^\n\[\]]*)\]:` + INLINE_WHITESPACE + `*` +
+		`(` + CHAR + `+)$`
 
-	CODEBLOCK_DELIMITER_PATTERN = `\x60\x60\x60` + CHAR + `*`
+	EMBED_PATTERN = `^` + INLINE_WHITESPACE + `*` + `!\[\[([^\n\[\]]+)\]\]` + INLINE_WHITESPACE + `*$`
 
-	CALLOUT_NOTE_PATTERN      = INLINE_WHITESPACE + `*` + `>\s\[!NOTE\]` + INLINE_WHITESPACE + `*`
-	CALLOUT_IMPORTANT_PATTERN = INLINE_WHITESPACE + `*` + `>\s\[!IMPORTANT\]` + INLINE_WHITESPACE + `*`
-	CALLOUT_WARNING_PATTERN   = INLINE_WHITESPACE + `*` + `>\s\[!WARNING\]` + INLINE_WHITESPACE + `*`
-	CALLOUT_EXAMPLE_PATTERN   = INLINE_WHITESPACE + `*` + `>\s\[!EXAMPLE\]` + INLINE_WHITESPACE + `*`
+	FOOTNOTE_DEF_PATTERN = INLINE_WHITESPACE + `*` + `\[\^[^\s\]]+\]:` + INLINE_WHITESPACE + `*`
 
-	QUOTE_PATTERN = INLINE_WHITESPACE + `*` + `>` + INLINE_WHITESPACE
+	// Groups: indentation, fence, info string
+	CODEBLOCK_DELIMITER_PATTERN = `^(` + INLINE_WHITESPACE + `*)(\x60{3,}|~{3,})` + INLINE_WHITESPACE + `*` + `(` + CHAR + `*)$`
+
+	TABLE_ROW_PATTERN       = INLINE_WHITESPACE + `*` + `\|?` + CHAR + `*\|` + CHAR + `*`
+	TABLE_ALIGNMENT_PATTERN = `^` + INLINE_WHITESPACE + `*` + `\|?` + INLINE_WHITESPACE + `*` + `:?-+:?` +
+		`(` + INLINE_WHITESPACE + `*\|` + INLINE_WHITESPACE + `*` + `:?-+:?` + `)*` +
+		INLINE_WHITESPACE + `*` + `\|?` + INLINE_WHITESPACE + `*$`
+
+	// Groups: type, fold state. Matched on the first line of a quote, the rest of the line is the title
+	CALLOUT_PATTERN = `^\[!([a-zA-Z-]+)\]([+-]?)` + INLINE_WHITESPACE + `*`
+
+	// The quote marker and the optional space after it
+	QUOTE_PATTERN = `^` + INLINE_WHITESPACE + `*` + `> ?`
 
 	PARAGRAPH_PATTERN = CHAR + `+`
 
 	// Patterns for inline elements
-	LINK_PATTERN        = `\[[^\n\[\]\(\)]*\]\([^\n\[\]\(\)]*\)`
-	INLINE_CODE_PATTERN = `\x60` + `[^\n\x60]` + `*` + `\x60`
+	LINK_PATTERN         = `\[[^\n\[\]\(\)]*\]\([^\n\[\]\(\)]*\)`
+	IMAGE_PATTERN        = `!` + LINK_PATTERN
+	INLINE_CODE_PATTERN  = `\x60` + `[^\n\x60]` + `*` + `\x60`
+	FOOTNOTE_REF_PATTERN = `\[\^[^\s\]]+\]`
+	AUTOLINK_PATTERN     = `<https?://[^\s<>]+>`
+	LINK_REF_PATTERN     = `\[[^\n\[\]]+\]\[[^\n\[\]]*\]`
+	WIKILINK_PATTERN     = `\[\[[^\n\[\]]+\]\]`
+	SHORTCUT_REF_PATTERN = `\[[^\n\[\]]+\]`
+	BARE_URL_PATTERN     = `https?://[^\s<>]+`
+
+	// Any ASCII punctuation can be escaped by a backslash
+	ESCAPE_PATTERN = `\\[!-/:-@\[-\x60{-~]`
+	// Two trailing spaces or a backslash at the end of the line
+	HARD_BREAK_PATTERN = `(?:` + INLINE_WHITESPACE + `{2,}|\\)\n`
+
+	// Comments can span multiple lines, an unclosed comment runs to the end of the document
+	COMMENT_PATTERN  = `%%[\s\S]*?(?:%%|$)`
+	BLOCK_ID_PATTERN = `^\^([a-zA-Z0-9-]+)` + INLINE_WHITESPACE + `*$`
+	ENTITY_PATTERN   = `&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`
+	// Every inline element starts with one of these characters, anything else is text
+	INLINE_START_CHARS = " \t\n\f\r\\%^$&\x60[!<h:*_~="
+	// Emoji and Nerd Font shortcodes, e.g. :rocket: or :nf-dev-go:
+	SHORTCODE_PATTERN = `:[a-zA-Z0-9_+-]+:`
+)
+
+// Patterns matched at the current position are anchored, so a failed match stops at the
+// first character that doesn't fit instead of searching the rest of the source
+var (
+	indentRegex          = anchored(INLINE_WHITESPACE + `*`)
+	skipNewlineRegex     = anchored(SKIP_NEWLINE_PATTERN)
+	setextUnderlineRegex = regexp.MustCompile(SETEXT_UNDERLINE_PATTERN)
+	paragraphRegex       = anchored(PARAGRAPH_PATTERN)
+
+	heading6Regex = anchored(HEADING_6_PATTERN)
+	heading5Regex = anchored(HEADING_5_PATTERN)
+	heading4Regex = anchored(HEADING_4_PATTERN)
+	heading3Regex = anchored(HEADING_3_PATTERN)
+	heading2Regex = anchored(HEADING_2_PATTERN)
+	heading1Regex = anchored(HEADING_1_PATTERN)
+
+	numberedListRegex   = anchored(NUMBERED_LIST_PATTERN)
+	hyphenListRegex     = anchored(HYPHEN_LIST_PATTERN)
+	taskListRegex       = anchored(TASK_LIST_PATTERN)
+	horizontalRuleRegex = regexp.MustCompile(`^(` + HORIZONTAL_RULE_PATTERN + `)$`)
+
+	linkDefRegex            = regexp.MustCompile(LINK_DEF_PATTERN)
+	embedRegex              = regexp.MustCompile(EMBED_PATTERN)
+	footnoteDefRegex        = anchored(FOOTNOTE_DEF_PATTERN)
+	footnoteLabelRegex      = regexp.MustCompile(`\[\^([^\s\]]+)\]`)
+	codeBlockDelimiterRegex = regexp.MustCompile(CODEBLOCK_DELIMITER_PATTERN)
+	tableRowRegex           = regexp.MustCompile(`^` + TABLE_ROW_PATTERN + `$`)
+	tableAlignmentRegex     = regexp.MustCompile(TABLE_ALIGNMENT_PATTERN)
+	calloutRegex            = regexp.MustCompile(CALLOUT_PATTERN)
+	quoteRegex              = regexp.MustCompile(QUOTE_PATTERN)
+
+	frontmatterDelimiterRegex = regexp.MustCompile(`^---` + INLINE_WHITESPACE + `*$`)
+
+	linkRegex        = anchored(LINK_PATTERN)
+	imageRegex       = anchored(IMAGE_PATTERN)
+	inlineCodeRegex  = anchored(INLINE_CODE_PATTERN)
+	footnoteRefRegex = anchored(FOOTNOTE_REF_PATTERN)
+	autolinkRegex    = anchored(AUTOLINK_PATTERN)
+	linkRefRegex     = anchored(LINK_REF_PATTERN)
+	wikilinkRegex    = anchored(WIKILINK_PATTERN)
+	shortcutRefRegex = anchored(SHORTCUT_REF_PATTERN)
+	bareUrlRegex     = anchored(BARE_URL_PATTERN)
+	escapeRegex      = anchored(ESCAPE_PATTERN)
+	hardBreakRegex   = anchored(HARD_BREAK_PATTERN)
+	commentRegex     = anchored(COMMENT_PATTERN)
+	blockIdRegex     = regexp.MustCompile(BLOCK_ID_PATTERN)
+	entityRegex      = anchored(ENTITY_PATTERN)
+	shortcodeRegex   = anchored(SHORTCODE_PATTERN)
+
+	// Parts of the inline elements, matched against the element only
+	bracketRegex        = regexp.MustCompile(`\[` + CHAR + `*` + `\]`)
+	parenthesisRegex    = regexp.MustCompile(`\(` + CHAR + `*` + `\)`)
+	linkTargetRegex     = regexp.MustCompile(`^<?([^\s<>]*)>?(?:` + INLINE_WHITESPACE + `+(?:"([^"]*)"|'([^']*)'|\(([^()]*)\)))?$`)
+	linkRefPartsRegex   = regexp.MustCompile(`^\[([^\n\[\]]+)\](?:\[([^\n\[\]]*)\])?$`)
+	inlineCodeSpanRegex = regexp.MustCompile(INLINE_CODE_PATTERN)
+	schemeOnlyRegex     = regexp.MustCompile(`^https?://$`)
+	alphanumericRegex   = regexp.MustCompile(`[a-zA-Z0-9]`)
+
+	// Obsidian allows spaces in the destination of links and images, e.g. ![](my image.png "Title")
+	spacedLinkTargetRegex = regexp.MustCompile(`^<?(.*?)>?(?:` + INLINE_WHITESPACE + `+(?:"([^"]*)"|'([^']*)'|\(([^()]*)\)))?$`)
 )
 
+func anchored(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:` + pattern + `)`)
+}
+
 type patternMatch func(lex *lexer) string
 
 type patternHandler func(lex *lexer, matchStr string)
@@ -54,6 +170,20 @@ type lexer struct {
 	tokens       []Token
 	source       string
 	pos          int
+	// Problems found so far, the lexer carries on past them
+	diagnostics []Diagnostic
+	// The source is the part of the document read so far, more lines may follow it
+	partial bool
+	// A block found so far may still change with the lines after the source, e.g. an unclosed
+	// $$ waiting for its closing line, so the blocks from there can't be complete yet
+	pending bool
+	// Offset past the line break of the line found last by remainderOfLine
+	lineEnd int
+	// Inside the text of a link, where autolinks would be links nested in the link
+	inLink bool
+	// Offsets past which no closing delimiter is left, by delimiter, so an unclosed delimiter
+	// isn't searched for again from every opening one
+	unclosed map[string]int
 }
 
 func NewLexer(source string, constructors []patternConstructor) *lexer {
@@ -82,133 +212,972 @@ func (lex *lexer) at_eof() bool {
 }
 
 func (lex *lexer) isOnNewLine() bool {
-	return lex.pos == 0 || string(lex.source[lex.pos-1]) == "\n"
+	return lex.pos == 0 || lex.source[lex.pos-1] == '\n'
 }
 
-func (lex *lexer) isChildOfQuote() bool {
-	return lex.tokens[len(lex.tokens)-1].Kind == QUOTE
+// Return the rest of the current line, without the line break
+func (lex *lexer) currentLine() string {
+	return lineAt(lex.source, lex.pos)
 }
 
-// Get the xy-plane location of the current position
-func (lex *lexer) getLoc(pos int) [2]int {
-	tokenizedString := lex.source[:pos]
-	lines := strings.Split(tokenizedString, "\n")
-	lastLine := lines[len(lines)-1]
+// Return the rest of the current line including the line break, inline elements other than
+// comments and emphasis can't span lines so there is no need to look further. The end of
+// the line is only searched once per line, the lexer never moves back
+func (lex *lexer) remainderOfLine() string {
+	if lex.pos >= lex.lineEnd {
+		lex.lineEnd = min(lex.pos+len(lex.currentLine())+1, len(lex.source))
+	}
+
+	return lex.source[lex.pos:lex.lineEnd]
+}
 
-	return [2]int{len(lines) - 1, len(lastLine)}
+// Number of bytes between the offsets whose rune counts are kept by the line index
+const RUNE_COUNT_INTERVAL = 64
+
+// Offsets of the start of each line, to find the line and column of an offset. The
+// source can be a part of the document starting at a line, found at the start position
+type lineIndex struct {
+	source     string
+	lineStarts []int
+	// Number of runes before every RUNE_COUNT_INTERVAL bytes, so the columns on a long
+	// line aren't counted from the start of the line
+	runeCounts []int
+	start      Position
 }
 
-func blockTokenMatch(regex string) patternMatch {
-	return func(lex *lexer) string {
-		matchLoc := regexp.MustCompile(regex).FindStringIndex(lex.remainder())
+func newLineIndex(source string, start Position) lineIndex {
+	lineStarts := []int{0}
+	runeCounts := make([]int, 0, len(source)/RUNE_COUNT_INTERVAL+1)
+	runes := 0
+
+	for i := 0; i < len(source); i++ {
+		if i%RUNE_COUNT_INTERVAL == 0 {
+			runeCounts = append(runeCounts, runes)
+		}
+
+		if utf8.RuneStart(source[i]) {
+			runes++
+		}
+
+		if source[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	runeCounts = append(runeCounts, runes)
+
+	return lineIndex{source: source, lineStarts: lineStarts, runeCounts: runeCounts, start: start}
+}
+
+// Return the number of runes before the offset
+func (index lineIndex) runesBefore(offset int) int {
+	interval := offset / RUNE_COUNT_INTERVAL
+	runes := index.runeCounts[interval]
+
+	for i := interval * RUNE_COUNT_INTERVAL; i < offset; i++ {
+		if utf8.RuneStart(index.source[i]) {
+			runes++
+		}
+	}
+
+	return runes
+}
+
+// Return the position in the document of the offset in the source, columns are counted
+// in runes so letters with diacritics take up a single column
+func (index lineIndex) position(offset int) Position {
+	line := sort.Search(len(index.lineStarts), func(i int) bool { return index.lineStarts[i] > offset }) - 1
 
-		if matchLoc != nil && matchLoc[0] == 0 && (lex.isOnNewLine() || lex.isChildOfQuote()) {
-			return lex.remainder()[matchLoc[0]:matchLoc[1]]
-		} else {
+	return Position{
+		Offset: index.start.Offset + offset,
+		Line:   index.start.Line + line,
+		Column: index.runesBefore(offset) - index.runesBefore(index.lineStarts[line]),
+	}
+}
+
+// Return the line starting at the position, without the line break
+func lineAt(source string, pos int) string {
+	if end := strings.IndexByte(source[pos:], '\n'); end >= 0 {
+		return source[pos : pos+end]
+	}
+
+	return source[pos:]
+}
+
+// Iterate over the lines from the position to the end of the source, yielding the
+// offset and the content of each line, same as splitting the rest of the source by line breaks
+func linesFrom(source string, pos int) iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		for pos <= len(source) {
+			line := lineAt(source, pos)
+
+			if !yield(pos, line) {
+				return
+			}
+
+			pos += len(line) + 1
+		}
+	}
+}
+
+// Block elements start at the beginning of a line, their markers don't span lines
+func blockTokenMatch(regex *regexp.Regexp) patternMatch {
+	return func(lex *lexer) string {
+		if !lex.isOnNewLine() {
 			return ""
 		}
+
+		return regex.FindString(lex.currentLine())
 	}
 }
 
-func inlineTokenMatch(regex string) patternMatch {
+func inlineTokenMatch(regex *regexp.Regexp) patternMatch {
 	return func(lex *lexer) string {
-		matchLoc := regexp.MustCompile(regex).FindStringIndex(lex.remainder())
+		return regex.FindString(lex.remainderOfLine())
+	}
+}
 
-		if matchLoc != nil && matchLoc[0] == 0 {
-			return lex.remainder()[matchLoc[0]:matchLoc[1]]
-		} else {
+// Only try to match at the characters the element can start with, so the pattern isn't run
+// against the rest of the line at every other position
+func startingWith(chars string, match patternMatch) patternMatch {
+	return func(lex *lexer) string {
+		if lex.at_eof() || strings.IndexByte(chars, lex.source[lex.pos]) < 0 {
 			return ""
 		}
+
+		return match(lex)
 	}
 }
 
 func blockTokenHandler(kind TokenKind) patternHandler {
 	return func(lex *lexer, matchStr string) {
-		rightside_indent := regexp.MustCompile(`^` + INLINE_WHITESPACE + `*`).FindString(matchStr)
+		rightside_indent := indentRegex.FindString(matchStr)
 
-		startLoc := lex.getLoc(lex.pos + len(rightside_indent))
+		startLoc := lex.pos + len(rightside_indent)
 		lex.advanceN(len(matchStr))
-		endLoc := lex.getLoc(lex.pos - 1)
+		endLoc := lex.pos
 
 		lex.push(NewToken(kind, NewLoc(startLoc, endLoc), matchStr[len(rightside_indent):]))
 	}
 }
 
-func headingMatch(regex string) patternMatch {
-	return func(lex *lexer) string {
-		matchLoc := regexp.MustCompile(regex).FindStringIndex(lex.remainder())
+func taskListHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+
+	state := "unchecked"
+	if strings.ContainsAny(matchStr, "xX") {
+		state = "checked"
+	}
+
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(TASK_LIST, NewLoc(startLoc, endLoc), state, matchStr[len(rightside_indent):len(rightside_indent)+1]))
+}
+
+// Quotes take up every following line starting with the quote marker
+func quoteMatch(lex *lexer) string {
+	if !lex.isOnNewLine() {
+		return ""
+	}
+
+	end := lex.pos
+	// Content of the previous line without the quote markers
+	content := ""
+
+	for lineStart, line := range linesFrom(lex.source, lex.pos) {
+		if marker := quoteRegex.FindString(line); marker != "" {
+			content = line
+			for marker != "" {
+				content = content[len(marker):]
+				marker = quoteRegex.FindString(content)
+			}
+
+			end = lineStart + len(line)
+			continue
+		}
+
+		// Lazy continuation, a paragraph inside the quote continues on lines without the marker
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(content) == "" ||
+			lex.startsBlock(content, false) || lex.startsBlock(line, false) {
+			break
+		}
+
+		end = lineStart + len(line)
+	}
+
+	return lex.source[lex.pos:end]
+}
+
+// The content of the quote is tokenized as a document of its own, with the locations
+// of its tokens moved back to where they are in the quote. Quotes with a callout marker
+// on the first line become callouts, Values: type, fold state ("-" folded, "+" expanded
+// or empty when not foldable)
+func quoteHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+
+	lines := strings.Split(matchStr, "\n")
+	markerLens := make([]int, len(lines))
+	// Offsets of the lines in the source and in the content without the markers
+	lineStarts := make([]int, len(lines))
+	contentStarts := make([]int, len(lines))
+
+	for i, line := range lines {
+		markerLens[i] = len(quoteRegex.FindString(line))
+		lines[i] = line[markerLens[i]:]
+
+		if i > 0 {
+			lineStarts[i] = lineStarts[i-1] + len(lines[i-1]) + markerLens[i-1] + 1
+			contentStarts[i] = contentStarts[i-1] + len(lines[i-1]) + 1
+		}
+	}
+
+	quoteStart := lex.pos
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	// Move the offset in the content, starting from the first line, to the offset in the source
+	relocate := func(offset int, firstLine int) int {
+		offset += contentStarts[firstLine]
+		line := sort.Search(len(contentStarts), func(i int) bool { return contentStarts[i] > offset }) - 1
+
+		return quoteStart + lineStarts[line] + markerLens[line] + offset - contentStarts[line]
+	}
+
+	firstLine := 0
+
+	if parts := calloutRegex.FindStringSubmatch(lines[0]); parts != nil {
+		lex.push(NewToken(CALLOUT, NewLoc(startLoc, endLoc), strings.ToLower(parts[1]), parts[2]))
+
+		// The title is the value of the callout
+		title := tokenizeInline(lines[0][len(parts[0]):], len(parts[0]), false)
+		for _, token := range title {
+			token.Loc = NewLoc(relocate(token.Loc.Start.Offset, 0), relocate(token.Loc.End.Offset, 0))
+			lex.push(token)
+		}
+
+		firstLine = 1
+	} else {
+		lex.push(NewToken(QUOTE, NewLoc(startLoc, endLoc)))
+	}
+
+	if firstLine == len(lines) {
+		return
+	}
+
+	contentLex := NewLexer(strings.Join(lines[firstLine:], "\n"), blockConstructors())
+
+	for _, token := range contentLex.tokenize() {
+		token.Loc = NewLoc(relocate(token.Loc.Start.Offset, firstLine), relocate(token.Loc.End.Offset, firstLine))
+		lex.push(token)
+	}
+
+	for _, diagnostic := range contentLex.diagnostics {
+		diagnostic.offset = relocate(diagnostic.offset, firstLine)
+		lex.diagnostics = append(lex.diagnostics, diagnostic)
+	}
+}
+
+func footnoteDefHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+	label := footnoteLabelRegex.FindStringSubmatch(matchStr)[1]
+
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(FOOTNOTE_DEF, NewLoc(startLoc, endLoc), label))
+}
+
+func linkDefMatch(lex *lexer) string {
+	line := lex.currentLine()
+
+	if !lex.isOnNewLine() {
+		return ""
+	}
+
+	// The destination is a single link with an optional title, so prose like
+	// `[Update]: the API changed` stays a paragraph
+	parts := linkDefRegex.FindStringSubmatch(line)
+	if parts == nil {
+		return ""
+	}
+
+	if target := linkTargetRegex.FindStringSubmatch(strings.TrimSpace(parts[2])); target == nil || target[1] == "" {
+		return ""
+	}
+
+	return line
+}
+
+func linkDefHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+	parts := linkDefRegex.FindStringSubmatch(matchStr)
+	link, title := splitLinkTitle(parts[2])
+
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(LINK_DEF, NewLoc(startLoc, endLoc), parts[1], link, title))
+}
+
+// Embeds take up the whole line, the embedded note is rendered in place of the line
+func embedMatch(lex *lexer) string {
+	line := lex.currentLine()
+
+	if !lex.isOnNewLine() || !embedRegex.MatchString(line) {
+		return ""
+	}
+
+	return line
+}
+
+// Values: note, heading, alias
+func embedHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+	note, heading, alias := splitWikilink(embedRegex.FindStringSubmatch(matchStr)[1])
 
-		if matchLoc != nil && matchLoc[0] == 0 && lex.isOnNewLine() {
-			return lex.remainder()[matchLoc[0]:matchLoc[1]]
-		} else {
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(EMBED, NewLoc(startLoc, endLoc), note, heading, alias))
+}
+
+func headingMatch(regex *regexp.Regexp) patternMatch {
+	return func(lex *lexer) string {
+		if !lex.isOnNewLine() {
 			return ""
 		}
+
+		return regex.FindString(lex.currentLine())
 	}
 }
 
 func inlineCodeHandler(lex *lexer, matchStr string) {
-	startLoc := lex.getLoc(lex.pos)
+	startLoc := lex.pos
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+	endLoc := lex.pos
 
 	lex.push(NewToken(INLINE_CODE, NewLoc(startLoc, endLoc), matchStr[1:len(matchStr)-1]))
 }
 
-func boldTextHandler(lex *lexer, matchStr string) {
-	startLoc := lex.getLoc(lex.pos)
+// Handler for inline elements wrapped by a delimiter on both sides, the content
+// between the delimiters is tokenized again so inline elements can be nested
+func inlineContainerHandler(kind TokenKind, delimiterLen int) patternHandler {
+	return func(lex *lexer, matchStr string) {
+		content := matchStr[delimiterLen : len(matchStr)-delimiterLen]
+
+		startLoc := lex.pos
+		lex.advanceN(len(matchStr))
+		endLoc := lex.pos
+
+		lex.push(NewToken(kind, NewLoc(startLoc, endLoc), content))
+		lex.tokens = append(lex.tokens, tokenizeInline(content, startLoc+delimiterLen, lex.inLink)...)
+	}
+}
+
+func linkHandler(lex *lexer, matchStr string) {
+	placeholder := bracketRegex.FindString(matchStr)
+	link := parenthesisRegex.FindString(matchStr)
+
+	placeholder = placeholder[1 : len(placeholder)-1]
+	link, title := splitLinkTitle(link[1 : len(link)-1])
+
+	startLoc := lex.pos
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+	endLoc := lex.pos
+
+	lex.push(NewToken(LINK, NewLoc(startLoc, endLoc), placeholder, link, title))
+
+	if placeholder != "" {
+		lex.tokens = append(lex.tokens, tokenizeInline(placeholder, startLoc+1, true)...)
+	}
+}
+
+// Split the link destination from the optional title, e.g. https://example.com "Example"
+func splitLinkTitle(target string) (string, string) {
+	parts := spacedLinkTargetRegex.FindStringSubmatch(strings.TrimSpace(target))
+
+	if parts == nil {
+		return strings.TrimSpace(target), ""
+	}
 
-	lex.push(NewToken(BOLD_TEXT, NewLoc(startLoc, endLoc), matchStr[2:len(matchStr)-2]))
+	return parts[1], parts[2] + parts[3] + parts[4]
 }
 
-func italicTextHandler(lex *lexer, matchStr string) {
-	startLoc := lex.getLoc(lex.pos)
+// Handler for [text][ref], [text][] and [ref], the reference is resolved
+// against the link definitions when the AST is parsed
+func linkRefHandler(lex *lexer, matchStr string) {
+	parts := linkRefPartsRegex.FindStringSubmatch(matchStr)
+	placeholder, label := parts[1], parts[2]
+
+	form := "full"
+	if strings.Count(matchStr, "[") == 1 {
+		form = "shortcut"
+		label = placeholder
+	} else if label == "" {
+		form = "collapsed"
+		label = placeholder
+	}
+
+	startLoc := lex.pos
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+	endLoc := lex.pos
 
-	lex.push(NewToken(ITALIC_TEXT, NewLoc(startLoc, endLoc), matchStr[1:len(matchStr)-1]))
+	lex.push(NewToken(LINK_REF, NewLoc(startLoc, endLoc), placeholder, label, form, matchStr))
+	lex.tokens = append(lex.tokens, tokenizeInline(placeholder, startLoc+1, true)...)
 }
 
-func linkHandler(lex *lexer, matchStr string) {
-	placeholder := regexp.MustCompile(`\[` + CHAR + `*` + `\]`).FindString(matchStr)
-	link := regexp.MustCompile(`\(` + CHAR + `*` + `\)`).FindString(matchStr)
+// Split the wiki link into the note name, heading and alias, e.g. [[Note#Heading|Alias]]
+func splitWikilink(content string) (string, string, string) {
+	target, alias, _ := strings.Cut(content, "|")
+	// Pipes are escaped inside tables
+	target = strings.TrimSuffix(target, "\\")
+	note, heading, _ := strings.Cut(target, "#")
 
-	placeholder = placeholder[1 : len(placeholder)-1]
-	link = link[1 : len(link)-1]
+	return strings.TrimSpace(note), strings.TrimSpace(heading), strings.TrimSpace(alias)
+}
+
+// Values: note, heading, alias
+func wikilinkHandler(lex *lexer, matchStr string) {
+	note, heading, alias := splitWikilink(matchStr[2 : len(matchStr)-2])
+
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(WIKILINK, NewLoc(startLoc, endLoc), note, heading, alias))
+}
+
+func footnoteRefHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(FOOTNOTE_REF, NewLoc(startLoc, endLoc), matchStr[2:len(matchStr)-1]))
+}
+
+// Bare URLs must not start in the middle of a word, trailing punctuation and
+// unbalanced closing parentheses are not considered part of the URL
+func bareUrlMatch(lex *lexer) string {
+	if lex.pos > 0 && alphanumericRegex.MatchString(lex.source[lex.pos-1:lex.pos]) {
+		return ""
+	}
+
+	matchStr := inlineTokenMatch(bareUrlRegex)(lex)
+
+	for matchStr != "" {
+		last := matchStr[len(matchStr)-1]
+
+		if strings.ContainsRune(".,:;!?\"'*_~", rune(last)) ||
+			(last == ')' && strings.Count(matchStr, "(") < strings.Count(matchStr, ")")) {
+			matchStr = matchStr[:len(matchStr)-1]
+			continue
+		}
+
+		break
+	}
+
+	if schemeOnlyRegex.MatchString(matchStr) {
+		return ""
+	}
+
+	return matchStr
+}
+
+// Links can't be nested, a URL in the text of a link is text
+func outsideLinks(match patternMatch) patternMatch {
+	return func(lex *lexer) string {
+		if lex.inLink {
+			return ""
+		}
+
+		return match(lex)
+	}
+}
+
+// Autolinks use the URL as the placeholder, so they flow through the link preview
+func autolinkHandler(lex *lexer, matchStr string) {
+	link := strings.TrimSuffix(strings.TrimPrefix(matchStr, "<"), ">")
+
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(LINK, NewLoc(startLoc, endLoc), link, link, ""))
+}
+
+func imageHandler(lex *lexer, matchStr string) {
+	alt := bracketRegex.FindString(matchStr)
+	src := parenthesisRegex.FindString(matchStr)
+
+	alt = alt[1 : len(alt)-1]
+	src, title := splitLinkTitle(src[1 : len(src)-1])
+
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(IMAGE, NewLoc(startLoc, endLoc), alt, src, title))
+}
+
+// The escaped character is kept as literal text
+func escapeHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(TEXT, NewLoc(startLoc, endLoc), matchStr[1:]))
+}
+
+// Unknown named entities are kept as is
+func entityHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(TEXT, NewLoc(startLoc, endLoc), html.UnescapeString(matchStr)))
+}
+
+// Inline math is wrapped by single $, the content can't start or end with a whitespace
+// and the closing $ can't be followed by a digit, so prices like $5 and $10 stay as text
+func mathInlineMatch(lex *lexer) string {
+	remainder := lex.remainder()
 
-	startLoc := lex.getLoc(lex.pos)
+	if len(remainder) < 3 || remainder[0] != '$' || remainder[1] == '$' || unicode.IsSpace(rune(remainder[1])) {
+		return ""
+	}
+
+	for end := 1; end < len(remainder); end++ {
+		switch remainder[end] {
+		case '\n':
+			return ""
+		case '\\':
+			end++
+		case '$':
+			if unicode.IsSpace(rune(remainder[end-1])) ||
+				(end+1 < len(remainder) && unicode.IsDigit(rune(remainder[end+1]))) {
+				return ""
+			}
+
+			return remainder[:end+1]
+		}
+	}
+
+	return ""
+}
+
+func mathInlineHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+	endLoc := lex.pos
+
+	lex.push(NewToken(MATH_INLINE, NewLoc(startLoc, endLoc), matchStr[1:len(matchStr)-1]))
+}
+
+// Check if the byte is part of a word, non-ASCII bytes belong to multibyte letters
+func isWordChar(char byte) bool {
+	return char >= 0x80 || unicode.IsLetter(rune(char)) || unicode.IsDigit(rune(char))
+}
+
+// Return the end of the code span, link or autolink at the offset, or the offset when there is
+// none. Emphasis can't be closed inside them, they are tokenized on their own
+func skipInlineElement(str string, i int) int {
+	var regexes []*regexp.Regexp
+
+	switch str[i] {
+	case '`':
+		regexes = []*regexp.Regexp{inlineCodeRegex}
+	case '[':
+		regexes = []*regexp.Regexp{wikilinkRegex, linkRegex, linkRefRegex}
+	case '<':
+		regexes = []*regexp.Regexp{autolinkRegex}
+	}
+
+	for _, regex := range regexes {
+		if match := regex.FindString(str[i:]); match != "" {
+			return i + len(match)
+		}
+	}
+
+	return i
+}
+
+// Find the first closing delimiter from the offset of the remainder, skipping escaped characters and
+// the inline elements emphasis can't be closed inside. The closer reports the length of the run of
+// delimiter characters at an offset and if it closes the emphasis. Return the offset and the length of
+// the closing delimiter, the length is 0 if there is none. Emphasis can span the lines of a paragraph
+func (lex *lexer) closingDelimiter(delimiter string, from int, closer func(str string, i int) (int, bool)) (int, int) {
+	if offset, ok := lex.unclosed[delimiter]; ok && lex.pos+from >= offset {
+		return 0, 0
+	}
+
+	str := lex.remainder()
+
+	for i := from; i < len(str); i++ {
+		if end := skipInlineElement(str, i); end > i {
+			i = end - 1
+			continue
+		}
+
+		if str[i] == '\\' {
+			// Skip the escaped character
+			i++
+			continue
+		}
+
+		length, closes := closer(str, i)
+		if closes {
+			return i, length
+		}
+
+		if length > 0 {
+			i += length - 1
+		}
+	}
+
+	if lex.unclosed == nil {
+		lex.unclosed = map[string]int{}
+	}
+	lex.unclosed[delimiter] = lex.pos + from
+
+	return 0, 0
+}
+
+// Emphasis between two of the same delimiters, the closest closing delimiter is used and anything
+// in between is tokenized again as nested inline elements
+func delimitedTextMatch(delimiter string) patternMatch {
+	return func(lex *lexer) string {
+		if !strings.HasPrefix(lex.remainder(), delimiter) {
+			return ""
+		}
+
+		closing, length := lex.closingDelimiter(delimiter, len(delimiter), func(str string, i int) (int, bool) {
+			// The emphasis isn't empty
+			if i == len(delimiter) || !strings.HasPrefix(str[i:], delimiter) {
+				return 0, false
+			}
+
+			return len(delimiter), true
+		})
+		if length == 0 {
+			return ""
+		}
+
+		return lex.remainder()[:closing+len(delimiter)]
+	}
+}
+
+// Underscores inside a word, e.g. snake_case_names, don't open or close italic text
+func italicTextMatch(lex *lexer) string {
+	remainder := lex.remainder()
+
+	if len(remainder) < 3 || remainder[0] != '_' || unicode.IsSpace(rune(remainder[1])) ||
+		(lex.pos > 0 && isWordChar(lex.source[lex.pos-1])) {
+		return ""
+	}
+
+	closing, length := lex.closingDelimiter("_", 1, func(str string, i int) (int, bool) {
+		if str[i] != '_' {
+			return 0, false
+		}
+
+		return 1, i > 1 && !unicode.IsSpace(rune(str[i-1])) && (i+1 == len(str) || !isWordChar(str[i+1]))
+	})
+	if length == 0 {
+		return ""
+	}
+
+	return remainder[:closing+1]
+}
+
+// Return the length of the run of the character at the start of the string
+func runLength(str string, char byte) int {
+	return len(str) - len(strings.TrimLeft(str, string(char)))
+}
+
+// Report the length of the run of asterisks at the offset and if it can close emphasis, a run not
+// preceded by a whitespace can
+func closingAsterisks(str string, i int) (int, bool) {
+	if str[i] != '*' {
+		return 0, false
+	}
+
+	return runLength(str[i:], '*'), !unicode.IsSpace(rune(str[i-1]))
+}
+
+// A run of three asterisks opens both bold and italic text, the run closing first tells which
+// one is inside the other: ***both***, ***italic* in bold** and ***bold** in italic*
+func boldTextMatch(lex *lexer) string {
+	remainder := lex.remainder()
+
+	if runLength(remainder, '*') == 3 {
+		closing, length := lex.closingDelimiter("***", 3, closingAsterisks)
+
+		switch {
+		case length == 2:
+			// Left to italicAsteriskMatch
+			return ""
+		case length >= 3:
+			return remainder[:closing+3]
+		}
+	}
+
+	return delimitedTextMatch("**")(lex)
+}
+
+// Italic text between single asterisks, unlike underscores they can be inside a word. Runs of two
+// asterisks in between open and close bold text inside the italic text
+func italicAsteriskMatch(lex *lexer) string {
+	remainder := lex.remainder()
+	opening := runLength(remainder, '*')
+
+	if (opening != 1 && opening != 3) || opening == len(remainder) || unicode.IsSpace(rune(remainder[opening])) ||
+		(lex.pos > 0 && lex.source[lex.pos-1] == '*') {
+		return ""
+	}
+
+	closing, length := lex.closingDelimiter("*", 1, func(str string, i int) (int, bool) {
+		length, closes := closingAsterisks(str, i)
+		return length, closes && length != 2
+	})
+	if length == 0 {
+		return ""
+	}
+
+	return remainder[:closing+length]
+}
 
-	lex.push(NewToken(LINK, NewLoc(startLoc, endLoc), placeholder, link))
+// Whitespaces at the end of the content are skipped
+func trailingWhitespacesMatch(lex *lexer) string {
+	if strings.TrimLeft(lex.remainder(), "\t\n\f\r ") != "" {
+		return ""
+	}
+
+	return lex.remainder()
 }
 
 func leftsideWhitespacesHandler(lex *lexer, matchStr string) {
 	lex.advanceN(len(matchStr))
 }
 
+// Check if the line opens or closes a comment, %% inside inline code doesn't count
+func togglesComment(line string) bool {
+	return strings.Count(inlineCodeSpanRegex.ReplaceAllString(line, ""), "%%")%2 == 1
+}
+
+// Check if a block element other than a paragraph starts at the beginning of the source,
+// partial when more lines may follow the source. A block still waiting for the lines after
+// the source leaves the lexer pending, the paragraph it ends may go on once they are read
+func (lex *lexer) startsBlock(source string, partial bool) bool {
+	probe := NewLexer(source, interruptingConstructors())
+	probe.partial = partial
+
+	for _, constructor := range probe.constructors {
+		if constructor.match(probe) != "" {
+			lex.pending = lex.pending || probe.pending
+			return true
+		}
+	}
+
+	return false
+}
+
+// Paragraphs take up the following lines until a blank line or another block element,
+// lines inside a comment always belong to the paragraph. ATX headings are a single line,
+// paragraphs followed by an underline are setext headings
+func paragraphMatch(lex *lexer) string {
+	line := paragraphRegex.FindString(lex.currentLine())
+	if line == "" {
+		return ""
+	}
+
+	if !lex.isOnNewLine() && lex.tokens[len(lex.tokens)-1].isOneOfKinds(
+		HEADING_1,
+		HEADING_2,
+		HEADING_3,
+		HEADING_4,
+		HEADING_5,
+		HEADING_6,
+	) {
+		return line
+	}
+
+	remainder := lex.remainder()
+	end := len(line)
+	inComment := togglesComment(line)
+
+	for end < len(remainder) {
+		nextLine := lineAt(remainder, end+1)
+
+		// Setext headings, the underline would otherwise be a horizontal rule
+		if !inComment && lex.isOnNewLine() && setextUnderlineRegex.MatchString(nextLine) {
+			end += len("\n") + len(nextLine)
+			break
+		}
+
+		if !inComment && (strings.TrimSpace(nextLine) == "" || lex.startsBlock(remainder[end+1:], lex.partial)) {
+			break
+		}
+
+		end += len("\n") + len(nextLine)
+
+		if togglesComment(nextLine) {
+			inComment = !inComment
+		}
+	}
+
+	return remainder[:end]
+}
+
 func paragraphHandler(lex *lexer, matchStr string) {
-	rightside_indent := regexp.MustCompile(`^` + INLINE_WHITESPACE + `*`).FindString(matchStr)
-	startLoc := lex.getLoc(lex.pos + len(rightside_indent))
+	rightside_indent := indentRegex.FindString(matchStr)
+	startLoc := lex.pos + len(rightside_indent)
+	content := matchStr[len(rightside_indent):]
+	onNewLine := lex.isOnNewLine()
+
+	lines := strings.Split(content, "\n")
+	underline := setextUnderlineRegex.FindStringSubmatch(lines[len(lines)-1])
+
+	if onNewLine && len(lines) > 1 && underline != nil {
+		kind := HEADING_2
+		if strings.HasPrefix(underline[1], "=") {
+			kind = HEADING_1
+		}
+
+		tokens := tokenizeInline(strings.Join(lines[:len(lines)-1], "\n"), startLoc, false)
+
+		lex.advanceN(len(matchStr))
+		endLoc := lex.pos
+
+		lex.push(NewToken(kind, NewLoc(startLoc, endLoc), underline[1]))
+		lex.tokens = append(lex.tokens, tokens...)
+
+		return
+	}
+
+	tokens := tokenizeInline(content, startLoc, false)
+
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	if !onNewLine {
+		// The content of list items, headings and footnote definitions, which end with it
+		lex.tokens[len(lex.tokens)-1].Loc.End.Offset = endLoc
+	} else if len(tokens) > 0 {
+		// Lines with nothing but comments don't create a paragraph
+		lex.push(NewToken(PARAGRAPH, NewLoc(startLoc, endLoc), content))
+	}
+
+	lex.tokens = append(lex.tokens, tokens...)
+}
+
+func hardBreakHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(HARD_BREAK, NewLoc(startLoc, endLoc)))
+}
+
+// Comments are the only inline elements spanning lines, so they are matched
+// against the rest of the source
+func commentMatch(lex *lexer) string {
+	if !strings.HasPrefix(lex.remainder(), "%%") {
+		return ""
+	}
+
+	return commentRegex.FindString(lex.remainder())
+}
+
+func commentHandler(lex *lexer, matchStr string) {
+	lex.advanceN(len(matchStr))
+}
+
+// Block IDs are at the end of the line, either after a whitespace or on their own line
+func blockIdMatch(lex *lexer) string {
+	if lex.pos > 0 && !unicode.IsSpace(rune(lex.source[lex.pos-1])) {
+		return ""
+	}
+
+	return blockIdRegex.FindString(lex.remainderOfLine())
+}
+
+// Values: id
+func blockIdHandler(lex *lexer, matchStr string) {
+	id := blockIdRegex.FindStringSubmatch(matchStr)[1]
+
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
 
-	if lex.isOnNewLine() || lex.isChildOfQuote() {
-		lex.push(NewToken(PARAGRAPH, NewLoc(startLoc, startLoc), matchStr[len(rightside_indent):]))
+	lex.push(NewToken(BLOCK_ID, NewLoc(startLoc, endLoc), id))
+}
+
+// Shortcodes must not start in the middle of a word, so times like 10:30:00 stay text
+func shortcodeMatch(lex *lexer) string {
+	if lex.pos > 0 && alphanumericRegex.MatchString(lex.source[lex.pos-1:lex.pos]) {
+		return ""
 	}
 
+	return inlineTokenMatch(shortcodeRegex)(lex)
+}
+
+// Values: name
+func shortcodeHandler(lex *lexer, matchStr string) {
+	startLoc := lex.pos
 	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(SHORTCODE, NewLoc(startLoc, endLoc), matchStr[1:len(matchStr)-1]))
+}
 
-	inlineLex := NewLexer(matchStr[len(rightside_indent):], []patternConstructor{
-		{inlineTokenMatch(`\s*$`), leftsideWhitespacesHandler},
-		{inlineTokenMatch(INLINE_CODE_PATTERN), inlineCodeHandler},
-		{inlineTokenMatch(LINK_PATTERN), linkHandler},
-		{inlineTokenMatch(`\*\*[^\n\*]*\*\*`), boldTextHandler},
-		{inlineTokenMatch(`_[^\n_]*_`), italicTextHandler},
+// Split the content into inline tokens, startLoc is the offset of the first
+// character of the content in the source. The text of links has no autolinks
+func tokenizeInline(source string, startLoc int, inLink bool) []Token {
+	inlineLex := NewLexer(source, []patternConstructor{
+		{trailingWhitespacesMatch, leftsideWhitespacesHandler},
+		{startingWith(INLINE_WHITESPACE_CHARS+"\\", inlineTokenMatch(hardBreakRegex)), hardBreakHandler},
+		{startingWith("\\", inlineTokenMatch(escapeRegex)), escapeHandler},
+		{commentMatch, commentHandler},
+		{startingWith("^", blockIdMatch), blockIdHandler},
+		{mathInlineMatch, mathInlineHandler},
+		{startingWith("&", inlineTokenMatch(entityRegex)), entityHandler},
+		{startingWith("\x60", inlineTokenMatch(inlineCodeRegex)), inlineCodeHandler},
+		{startingWith("[", inlineTokenMatch(footnoteRefRegex)), footnoteRefHandler},
+		{startingWith(":", shortcodeMatch), shortcodeHandler},
+		{startingWith("[", inlineTokenMatch(wikilinkRegex)), wikilinkHandler},
+		{startingWith("!", inlineTokenMatch(imageRegex)), imageHandler},
+		{startingWith("[", inlineTokenMatch(linkRegex)), linkHandler},
+		{outsideLinks(startingWith("<", inlineTokenMatch(autolinkRegex))), autolinkHandler},
+		{outsideLinks(startingWith("h", bareUrlMatch)), autolinkHandler},
+		{startingWith("[", inlineTokenMatch(linkRefRegex)), linkRefHandler},
+		{startingWith("[", inlineTokenMatch(shortcutRefRegex)), linkRefHandler},
+		{startingWith("*", boldTextMatch), inlineContainerHandler(BOLD_TEXT, 2)},
+		{italicTextMatch, inlineContainerHandler(ITALIC_TEXT, 1)},
+		{startingWith("*", italicAsteriskMatch), inlineContainerHandler(ITALIC_TEXT, 1)},
+		{startingWith("~", delimitedTextMatch("~~")), inlineContainerHandler(STRIKETHROUGH, 2)},
+		{startingWith("=", delimitedTextMatch("==")), inlineContainerHandler(HIGHLIGHT, 2)},
 	})
+	inlineLex.inLink = inLink
 
 	prevLoc := 0
 
 	for !inlineLex.at_eof() {
+		// Skip the text up to the next character that can start an inline element
+		if next := strings.IndexAny(inlineLex.remainder(), INLINE_START_CHARS); next != 0 {
+			if next < 0 {
+				next = len(inlineLex.remainder())
+			}
+
+			inlineLex.advanceN(next)
+			continue
+		}
+
 		for _, constructor := range inlineLex.constructors {
 			inlineMatchStr := constructor.match(inlineLex)
 			if inlineMatchStr != "" {
@@ -216,7 +1185,7 @@ func paragraphHandler(lex *lexer, matchStr string) {
 
 				if currentLoc != prevLoc {
 					inlineLex.push(
-						NewToken(TEXT, NewLoc([2]int{0, prevLoc}, [2]int{0, currentLoc - 1}),
+						NewToken(TEXT, NewLoc(prevLoc, currentLoc),
 							inlineLex.source[prevLoc:currentLoc]))
 				}
 
@@ -235,179 +1204,455 @@ func paragraphHandler(lex *lexer, matchStr string) {
 	if prevLoc < len(inlineLex.source) {
 		inlineLex.push(NewToken(
 			TEXT,
-			NewLoc([2]int{0, prevLoc}, [2]int{0, len(inlineLex.source) - 1}),
+			NewLoc(prevLoc, len(inlineLex.source)),
 			inlineLex.source[prevLoc:],
 		))
 	}
 
-	for i := range inlineLex.tokens {
-		inlineLex.tokens[i].Loc.start[0] = startLoc[0]
-		inlineLex.tokens[i].Loc.end[0] = startLoc[0]
-		inlineLex.tokens[i].Loc.start[1] += startLoc[1]
-		inlineLex.tokens[i].Loc.end[1] += startLoc[1]
+	tokens := []Token{}
+
+	for _, token := range inlineLex.tokens {
+		token.Loc.Start.Offset += startLoc
+		token.Loc.End.Offset += startLoc
+
+		// Escaped characters and entities are merged into the surrounding text
+		if len(tokens) > 0 && token.Kind == TEXT && tokens[len(tokens)-1].Kind == TEXT &&
+			tokens[len(tokens)-1].Loc.End.Offset == token.Loc.Start.Offset {
+			tokens[len(tokens)-1].Values[0] += token.Values[0]
+			tokens[len(tokens)-1].Loc.End = token.Loc.End
+			continue
+		}
+
+		tokens = append(tokens, token)
 	}
 
-	lex.tokens = append(lex.tokens, inlineLex.tokens...)
+	return tokens
 }
 
 func codeBlockMatch(lex *lexer) string {
-	codeBlockDelimPattern := `\x60\x60\x60` + INLINE_WHITESPACE + `*` + `[a-zA-Z\.-_]+`
-	codeBlockDelimBeginLoc := regexp.MustCompile(codeBlockDelimPattern).FindStringIndex(lex.remainder())
-
-	if codeBlockDelimBeginLoc != nil && codeBlockDelimBeginLoc[0] == 0 &&
-		(lex.isOnNewLine() || lex.isChildOfQuote()) {
-		matchStr := lex.remainder()[codeBlockDelimBeginLoc[0]:codeBlockDelimBeginLoc[1]] + "\n"
-
-		lines := strings.Split(lex.remainder(), "\n")[1:]
-		for _, line := range lines {
-			if regexp.MustCompile(`^\x60\x60\x60`).FindString(line) != "" {
-				matchStr += line
-				return matchStr
-			}
+	if !lex.isOnNewLine() {
+		return ""
+	}
 
-			matchStr += line + "\n"
-		}
+	opening := codeBlockDelimiterRegex.FindStringSubmatch(lex.currentLine())
+	if opening == nil {
+		return ""
+	}
 
-		return matchStr
-	} else {
+	fence := opening[2]
+
+	// Backticks in the info string would be ambiguous with inline code
+	if fence[0] == '`' && strings.Contains(opening[3], "`") {
 		return ""
 	}
+
+	end := lex.pos + len(opening[0])
+
+	for lineStart, line := range linesFrom(lex.source, end+1) {
+		end = lineStart + len(line)
+
+		if isClosingFence(line, fence) {
+			return lex.source[lex.pos:end]
+		}
+	}
+
+	// Unclosed fences run until the end of the document
+	return strings.TrimRight(lex.source[lex.pos:end], "\n")
+}
+
+// The closing fence must use the same character and be at least as long as the opening one
+func isClosingFence(line string, fence string) bool {
+	rest, found := strings.CutPrefix(strings.TrimLeft(line, INLINE_WHITESPACE_CHARS), fence)
+
+	return found && strings.TrimLeft(strings.TrimLeft(rest, fence[:1]), INLINE_WHITESPACE_CHARS) == ""
 }
 
 func codeBlockHandler(lex *lexer, matchStr string) {
 	lines := strings.Split(matchStr, "\n")
-	metadata := regexp.MustCompile(`[a-zA-Z\.-_]+`).FindString(lines[0])
-	code := strings.Join(lines[1:len(lines)-1], "\n")
+	opening := codeBlockDelimiterRegex.FindStringSubmatch(lines[0])
+	indentation, fence := opening[1], opening[2]
+
+	// The first word of the info string is the language/filename, the rest are attributes
+	info := strings.Fields(opening[3])
+	metadata, attributes := "", ""
+	if len(info) > 0 {
+		metadata = info[0]
+		attributes = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(opening[3]), metadata))
+	}
+
+	// Only the closing fence is left out of the code, the last line of an unclosed block is
+	// code even if it starts with the fence, e.g. ```js
+	codeLines := lines[1:]
+	if len(codeLines) > 0 && isClosingFence(codeLines[len(codeLines)-1], fence) {
+		codeLines = codeLines[:len(codeLines)-1]
+	} else {
+		lex.diagnostics = append(lex.diagnostics, newDiagnostic(
+			SEVERITY_WARNING, lex.pos+len(indentation),
+			"unclosed code block, it runs to the end of the document",
+		))
+	}
+
+	// Fences indented inside list items have the same indentation removed from the code
+	for i, line := range codeLines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if len(line)-len(trimmed) > len(indentation) {
+			trimmed = line[len(indentation):]
+		}
+
+		codeLines[i] = trimmed
+	}
+
+	code := strings.Join(codeLines, "\n")
 
-	startLoc := lex.getLoc(lex.pos)
+	startLoc := lex.pos + len(indentation)
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+	endLoc := lex.pos
 
-	lex.push(NewToken(CODE_BLOCK, NewLoc(startLoc, endLoc), metadata, code))
+	lex.push(NewToken(CODE_BLOCK, NewLoc(startLoc, endLoc), metadata, code, attributes))
 }
 
-func frontmatterMatch(lex *lexer) string {
-	horizontalRuleLoc := regexp.MustCompile(`---`).FindStringIndex(lex.remainder())
+// Display math starts with $$ at the beginning of a line and ends with $$ at the end of a line,
+// unclosed delimiters are treated as text. While more lines may follow, an unclosed block
+// takes up the rest of the source so it stays the last block until its closing line is read
+func mathBlockMatch(lex *lexer) string {
+	if !lex.isOnNewLine() {
+		return ""
+	}
 
-	if horizontalRuleLoc != nil && horizontalRuleLoc[0] == 0 && lex.isOnNewLine() {
-		matchStr := lex.remainder()[horizontalRuleLoc[0]:horizontalRuleLoc[1]] + "\n"
+	line := lex.currentLine()
+	firstLine := strings.TrimSpace(line)
 
-		lines := strings.Split(lex.remainder(), "\n")[1:]
-		for _, line := range lines {
-			if regexp.MustCompile(`^---`).FindString(line) != "" {
-				matchStr += line
-				return matchStr
-			}
+	if !strings.HasPrefix(firstLine, MATH_BLOCK_DELIMITER) {
+		return ""
+	}
+
+	if len(firstLine) > 2*len(MATH_BLOCK_DELIMITER) && strings.HasSuffix(firstLine, MATH_BLOCK_DELIMITER) {
+		return line
+	}
 
-			matchStr += line + "\n"
+	for lineStart, line := range linesFrom(lex.source, lex.pos+len(line)+1) {
+		if strings.HasSuffix(strings.TrimSpace(line), MATH_BLOCK_DELIMITER) {
+			return lex.source[lex.pos : lineStart+len(line)]
 		}
+	}
 
-		return matchStr
-	} else {
+	if lex.partial {
+		lex.pending = true
+		return lex.source[lex.pos:]
+	}
+
+	return ""
+}
+
+func mathBlockHandler(lex *lexer, matchStr string) {
+	rightside_indent := indentRegex.FindString(matchStr)
+
+	// Blocks still waiting for their closing line have no closing delimiter
+	tex := strings.TrimPrefix(strings.TrimSpace(matchStr), MATH_BLOCK_DELIMITER)
+	tex = strings.TrimSpace(strings.TrimSuffix(tex, MATH_BLOCK_DELIMITER))
+
+	startLoc := lex.pos + len(rightside_indent)
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	lex.push(NewToken(MATH_BLOCK, NewLoc(startLoc, endLoc), tex))
+}
+
+// Split a table row into its cells, returning the content and the offset
+// of each cell relative to the start of the row
+func splitTableRow(row string) ([]string, []int) {
+	cells := []string{}
+	offsets := []int{}
+
+	start := 0
+	inCode := false
+
+	for i := 0; i <= len(row); i++ {
+		if i < len(row) {
+			switch {
+			case row[i] == '\\':
+				i++
+				continue
+			case row[i] == '`':
+				inCode = !inCode
+				continue
+			case row[i] != '|' || inCode:
+				continue
+			}
+		}
+
+		cell := row[start:i]
+		leftTrimmed := strings.TrimLeft(cell, " \t")
+
+		cells = append(cells, strings.TrimSpace(cell))
+		offsets = append(offsets, start+len(cell)-len(leftTrimmed))
+		start = i + 1
+	}
+
+	// Leading and trailing pipes are optional and don't introduce empty cells
+	if strings.TrimSpace(row[:strings.IndexAny(row+"|", "|")]) == "" && len(cells) > 1 {
+		cells, offsets = cells[1:], offsets[1:]
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(row), "|") && len(cells) > 1 {
+		cells, offsets = cells[:len(cells)-1], offsets[:len(offsets)-1]
+	}
+
+	return cells, offsets
+}
+
+func tableMatch(lex *lexer) string {
+	if !lex.isOnNewLine() {
 		return ""
 	}
+
+	headerRow := lex.currentLine()
+	if lex.pos+len(headerRow) == len(lex.source) || !tableRowRegex.MatchString(headerRow) {
+		return ""
+	}
+
+	alignmentRow := lineAt(lex.source, lex.pos+len(headerRow)+1)
+	if !tableAlignmentRegex.MatchString(alignmentRow) {
+		return ""
+	}
+
+	header, _ := splitTableRow(headerRow)
+	alignments, _ := splitTableRow(alignmentRow)
+
+	if len(header) != len(alignments) {
+		return ""
+	}
+
+	end := lex.pos + len(headerRow) + 1 + len(alignmentRow)
+
+	for lineStart, line := range linesFrom(lex.source, end+1) {
+		if !tableRowRegex.MatchString(line) {
+			break
+		}
+
+		end = lineStart + len(line)
+	}
+
+	return lex.source[lex.pos:end]
 }
 
-func frontmatterHandler(lex *lexer, matchStr string) {
+func tableHandler(lex *lexer, matchStr string) {
 	lines := strings.Split(matchStr, "\n")
-	linesOfContent := lines[1 : len(lines)-1]
 
-	values := []string{}
+	startLoc := lex.pos
+	endLoc := lex.pos + len(matchStr)
+
+	delimiters, _ := splitTableRow(lines[1])
+	alignments := []string{}
+
+	for _, delimiter := range delimiters {
+		switch {
+		case strings.HasPrefix(delimiter, ":") && strings.HasSuffix(delimiter, ":"):
+			alignments = append(alignments, "center")
+		case strings.HasSuffix(delimiter, ":"):
+			alignments = append(alignments, "right")
+		case strings.HasPrefix(delimiter, ":"):
+			alignments = append(alignments, "left")
+		default:
+			alignments = append(alignments, "")
+		}
+	}
+
+	lex.push(NewToken(TABLE, NewLoc(startLoc, endLoc), alignments...))
 
-	for i, line := range linesOfContent {
-		propertyName := regexp.MustCompile(`^[a-zA-Z]+:`).FindString(line)
+	lineStart := lex.pos
 
-		if propertyName == "" {
+	for i, line := range lines {
+		// The alignment row is only used for the table's metadata
+		if i == 1 {
+			lineStart += len(line) + 1
 			continue
 		}
 
-		switch propertyName[:len(propertyName)-1] {
-		case "id":
-			values = append(values, "id", line[4:])
-		case "date":
-			values = append(values, "date", line[6:])
-		case "tags":
-			tags := ""
+		rowKind := "body"
+		if i == 0 {
+			rowKind = "header"
+		}
 
-			for j := i + 1; j < len(linesOfContent); j++ {
-				str := regexp.MustCompile(INLINE_WHITESPACE + `+` + `- [a-zA-Z0-9]+`).
-					FindString(linesOfContent[j])
-				tagName := regexp.MustCompile(`[a-zA-Z0-9]+`).FindString(str)
+		lex.push(NewToken(
+			TABLE_ROW,
+			NewLoc(lineStart, lineStart+len(line)),
+			rowKind,
+		))
 
-				if tagName == "" {
-					break
-				}
+		cells, offsets := splitTableRow(line)
 
-				tags += tagName + ","
+		// Missing cells are rendered empty and excess cells are ignored
+		for j := range alignments {
+			cell := ""
+			cellStart := lineStart + len(line)
+
+			if j < len(cells) {
+				cell = cells[j]
+				cellStart = lineStart + offsets[j]
 			}
 
-			values = append(values, "tags", tags)
+			cellLoc := cellStart
+
+			lex.push(NewToken(TABLE_CELL, NewLoc(cellLoc, cellStart+len(cell)), alignments[j]))
+
+			if cell != "" {
+				lex.tokens = append(lex.tokens, tokenizeInline(cell, cellLoc, false)...)
+			}
 		}
+
+		lineStart += len(line) + 1
 	}
 
-	startLoc := lex.getLoc(lex.pos)
 	lex.advanceN(len(matchStr))
-	endLoc := lex.getLoc(lex.pos - 1)
+}
+
+// The frontmatter can only be the first block of the document, any other
+// `---` line is a horizontal rule
+func frontmatterMatch(lex *lexer) string {
+	if lex.pos != 0 || !frontmatterDelimiterRegex.MatchString(lex.currentLine()) {
+		return ""
+	}
+
+	for lineStart, line := range linesFrom(lex.source, len(lex.currentLine())+1) {
+		if strings.HasPrefix(line, "---") {
+			return lex.source[:lineStart+len(line)]
+		}
+	}
 
-	lex.push(NewToken(FRONTMATTER, NewLoc(startLoc, endLoc), values...))
+	// Unclosed frontmatter takes up the whole document, every line after the opening one is content
+	return lex.source + "\n"
 }
 
-func skipLinesMatch(lex *lexer) string {
-	matchLoc := regexp.MustCompile(SKIP_NEWLINE_PATTERN).FindStringIndex(lex.remainder())
+// Horizontal rules must take up the whole line, otherwise the line can be a list item
+// or a paragraph starting with emphasis
+func horizontalRuleMatch(lex *lexer) string {
+	line := lex.currentLine()
 
-	if matchLoc != nil && matchLoc[0] == 0 {
-		return lex.remainder()[matchLoc[0]:matchLoc[1]]
-	} else {
-		return ""
+	if lex.isOnNewLine() && horizontalRuleRegex.MatchString(line) {
+		return line
+	}
+
+	return ""
+}
+
+func frontmatterHandler(lex *lexer, matchStr string) {
+	lines := strings.Split(matchStr, "\n")
+	linesOfContent := lines[1 : len(lines)-1]
+
+	if !strings.HasPrefix(lines[len(lines)-1], "---") {
+		lex.diagnostics = append(lex.diagnostics, newDiagnostic(
+			SEVERITY_WARNING, lex.pos, "unclosed frontmatter, the whole document is read as frontmatter",
+		))
+	}
+
+	// The YAML is kept as the value of the token, it is checked here to report its problems
+	content := strings.Join(linesOfContent, "\n")
+	contentStart := lex.pos + len(lines[0]) + len("\n")
+
+	_, diagnostics := parseFrontmatter(content)
+	for _, diagnostic := range diagnostics {
+		diagnostic.offset += contentStart
+		lex.diagnostics = append(lex.diagnostics, diagnostic)
 	}
+
+	startLoc := lex.pos
+	lex.advanceN(len(matchStr))
+	endLoc := lex.pos
+
+	// Unclosed frontmatter is matched with an extra line break past the end of the source
+	lex.push(NewToken(FRONTMATTER, NewLoc(startLoc, min(endLoc, len(lex.source))), content))
+}
+
+func skipLinesMatch(lex *lexer) string {
+	return skipNewlineRegex.FindString(lex.remainder())
 }
 
 func skipLinesHandler(lex *lexer, matchStr string) {
 	lex.advanceN(len(matchStr))
 }
 
-func Tokenize(source string) ([]Token, error) {
-	lex := NewLexer(source, []patternConstructor{
-		{frontmatterMatch, frontmatterHandler},
-		{skipLinesMatch, skipLinesHandler},
-		{headingMatch(HEADING_5_PATTERN), blockTokenHandler(HEADING_5)},
-		{headingMatch(HEADING_4_PATTERN), blockTokenHandler(HEADING_4)},
-		{headingMatch(HEADING_3_PATTERN), blockTokenHandler(HEADING_3)},
-		{headingMatch(HEADING_2_PATTERN), blockTokenHandler(HEADING_2)},
-		{headingMatch(HEADING_1_PATTERN), blockTokenHandler(HEADING_1)},
-		{blockTokenMatch(HYPHEN_LIST_PATTERN), blockTokenHandler(HYPHEN_LIST)},
-		{blockTokenMatch(NUMBERED_LIST_PATTERN), blockTokenHandler(NUMBERED_LIST)},
+// Constructors of the block elements that end the paragraph before them
+func interruptingConstructors() []patternConstructor {
+	return []patternConstructor{
+		{horizontalRuleMatch, blockTokenHandler(HORIZONTAL_RULE)},
+		{headingMatch(heading6Regex), blockTokenHandler(HEADING_6)},
+		{headingMatch(heading5Regex), blockTokenHandler(HEADING_5)},
+		{headingMatch(heading4Regex), blockTokenHandler(HEADING_4)},
+		{headingMatch(heading3Regex), blockTokenHandler(HEADING_3)},
+		{headingMatch(heading2Regex), blockTokenHandler(HEADING_2)},
+		{headingMatch(heading1Regex), blockTokenHandler(HEADING_1)},
+		{blockTokenMatch(taskListRegex), taskListHandler},
+		{blockTokenMatch(hyphenListRegex), blockTokenHandler(HYPHEN_LIST)},
+		{blockTokenMatch(numberedListRegex), blockTokenHandler(NUMBERED_LIST)},
+		{blockTokenMatch(footnoteDefRegex), footnoteDefHandler},
+		{embedMatch, embedHandler},
 		{codeBlockMatch, codeBlockHandler},
-		{blockTokenMatch(CALLOUT_NOTE_PATTERN), blockTokenHandler(CALLOUT_NOTE)},
-		{blockTokenMatch(CALLOUT_IMPORTANT_PATTERN), blockTokenHandler(CALLOUT_IMPORTANT)},
-		{blockTokenMatch(CALLOUT_WARNING_PATTERN), blockTokenHandler(CALLOUT_WARNING)},
-		{blockTokenMatch(CALLOUT_EXAMPLE_PATTERN), blockTokenHandler(CALLOUT_EXAMPLE)},
-		{blockTokenMatch(QUOTE_PATTERN), blockTokenHandler(QUOTE)},
-		{inlineTokenMatch(PARAGRAPH_PATTERN), paragraphHandler},
+		{mathBlockMatch, mathBlockHandler},
+		{tableMatch, tableHandler},
+		{quoteMatch, quoteHandler},
+	}
+}
+
+// Constructors of the block elements, shared by the document and the content of quotes
+func blockConstructors() []patternConstructor {
+	constructors := []patternConstructor{{skipLinesMatch, skipLinesHandler}}
+	constructors = append(constructors, interruptingConstructors()...)
+
+	// Link definitions can't interrupt a paragraph
+	return append(constructors,
+		patternConstructor{linkDefMatch, linkDefHandler},
+		patternConstructor{paragraphMatch, paragraphHandler},
+	)
+}
+
+// Split the source into tokens, the error is a list of Diagnostics when problems
+// are found and the tokens of the rest of the source are still returned
+func Tokenize(source string) ([]Token, error) {
+	var tokens []Token
+	var diagnostics Diagnostics
+
+	// The whole document is known, so it is tokenized in a single pass
+	stream := &tokenStream{buffer: []byte(source)}
+	stream.tokenize(len(source), true, func(token Token, err error) bool {
+		if err != nil {
+			// Every error of the stream without a reader is a diagnostic
+			diagnostics = append(diagnostics, err.(Diagnostic))
+			return true
+		}
+
+		tokens = append(tokens, token)
+		return true
 	})
 
+	if len(diagnostics) == 0 {
+		return tokens, nil
+	}
+
+	return tokens, diagnostics
+}
+
+func (lex *lexer) tokenize() []Token {
 	for !lex.at_eof() {
-		for _, constructor := range lex.constructors {
-			matchStr := constructor.match(lex)
+		lex.next()
+	}
 
-			// NOTE: Match should assure that both the match status and the match location
-			if matchStr != "" {
-				constructor.handler(lex, matchStr)
-				goto CONTINUE
-			}
-		}
-		goto ERROR
+	return lex.tokens
+}
 
-	CONTINUE:
-		continue
-	ERROR:
-		loc := lex.getLoc(lex.pos)
+// Tokenize the element at the current position with the first constructor matching it
+func (lex *lexer) next() {
+	for _, constructor := range lex.constructors {
+		matchStr := constructor.match(lex)
 
-		return nil, fmt.Errorf(
-			"Lexer::error -> unrecognized token near\n %s\nat [%d:%d]\n",
-			lex.remainder(), loc[0], loc[1],
-		)
+		// NOTE: Match should assure that both the match status and the match location
+		if matchStr != "" {
+			constructor.handler(lex, matchStr)
+			return
+		}
 	}
 
-	return lex.tokens, nil
+	// Skip the rest of the line, the next one may still be tokenized
+	lex.diagnostics = append(lex.diagnostics, newDiagnostic(SEVERITY_ERROR, lex.pos, "unrecognized token"))
+	lex.advanceN(max(len(lex.currentLine()), 1))
 }
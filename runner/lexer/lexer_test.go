@@ -0,0 +1,419 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+// A section using most of the block and inline elements, repeated to build large documents
+const benchmarkSection = `## Section %d
+
+A paragraph with **bold**, _italic_, ~~strikethrough~~, ==highlight==, ` + "`code`" + ` and $x^2$,
+a [link](https://example.com "Example"), a [[Note#Heading|wiki link]] and :rocket: ^block-%d
+
+- A list item with a [reference][ref]
+  - A nested item
+- [ ] A task
+1. A numbered item
+
+> [!note] A callout
+> With a second line
+
+` + "```go" + `
+func main() {}
+` + "```" + `
+
+| Name | Value |
+| :--- | ----: |
+| a    | 1     |
+
+[ref]: https://example.com
+`
+
+func generateDocument(sections int) string {
+	var builder strings.Builder
+
+	builder.WriteString("---\nid: benchmark\n---\n")
+
+	for i := range sections {
+		builder.WriteString(fmt.Sprintf(benchmarkSection, i, i))
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+// A document of paragraphs without headings, every block is a child of the root
+func generateFlatDocument(paragraphs int) string {
+	var builder strings.Builder
+
+	builder.WriteString("---\nid: flat\n---\n")
+
+	for i := range paragraphs {
+		builder.WriteString(fmt.Sprintf("Paragraph %d with **bold** and _italic_ text\n\n", i))
+	}
+
+	return builder.String()
+}
+
+// A document of a single line, every inline element is on it
+func generateLongLine(words int) string {
+	return "---\nid: long-line\n---\n" + strings.Repeat("plain _x_ words ", words) + "\n"
+}
+
+// A paragraph of delimiters never closed, each one opening emphasis that runs to the end of it
+func generateUnclosedEmphasis(words int) string {
+	return "---\nid: unclosed\n---\n" + strings.Repeat("_a *b ~~c ==d ", words) + "\n"
+}
+
+// Documents of growing sizes for the benchmarks, named after their kind and number of bytes
+func benchmarkDocuments() []struct{ name, source string } {
+	documents := []struct{ name, source string }{}
+
+	for _, size := range []int{100, 400, 1600} {
+		for _, document := range []struct{ name, source string }{
+			{"sections", generateDocument(size)},
+			{"flat", generateFlatDocument(10 * size)},
+			{"line", generateLongLine(10 * size)},
+			{"unclosed", generateUnclosedEmphasis(10 * size)},
+		} {
+			document.name = fmt.Sprintf("%s/bytes=%d", document.name, len(document.source))
+			documents = append(documents, document)
+		}
+	}
+
+	return documents
+}
+
+// Documents with blocks changed by the lines after them, which the stream has to hold back
+var streamDocuments = map[string]string{
+	"setext heading":                         "A paragraph\nturned into a heading\n===\n\nAnother one\n---\n",
+	"unclosed fence":                         "Some text\n\n```go\nfunc main() {}\n\n- not a list\n",
+	"unclosed frontmatter":                   "---\nid: note\ntitle: An unclosed frontmatter\n\n# Heading\n",
+	"lazy quote continuation":                "> A quote\ncontinued lazily\n> and **closed\nlater** on\n\nA paragraph\n",
+	"math block":                             "---\nid: x\n---\n$$\na\n\n" + strings.Repeat("b", 44) + " = 2\n$$\n\nafter\n",
+	"math block over a list":                 "Some text\n$$\na\n- b\n$$\n",
+	"unclosed math block":                    "Some text\n$$\n",
+	"unclosed math block without line break": "Text\n$$\nx",
+	"large document":                         generateDocument(400),
+}
+
+// Collect the tokens and diagnostics of the stream, as Tokenize does
+func collectStream(t *testing.T, reader io.Reader) ([]Token, Diagnostics) {
+	var tokens []Token
+	var diagnostics Diagnostics
+
+	for token, err := range TokenizeReader(reader) {
+		if err != nil {
+			diagnostic, ok := err.(Diagnostic)
+			if !ok {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			diagnostics = append(diagnostics, diagnostic)
+			continue
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, diagnostics
+}
+
+// The tokens shouldn't depend on where the reads of the document end
+func TestTokenizeReader(t *testing.T) {
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(reader io.Reader) io.Reader { return reader },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+
+	for name, source := range streamDocuments {
+		expectedTokens, err := Tokenize(source)
+
+		var expectedDiagnostics Diagnostics
+		if err != nil {
+			expectedDiagnostics = err.(Diagnostics)
+		}
+
+		for readerName, newReader := range readers {
+			t.Run(name+"/"+readerName, func(t *testing.T) {
+				tokens, diagnostics := collectStream(t, newReader(strings.NewReader(source)))
+
+				if !reflect.DeepEqual(tokens, expectedTokens) {
+					t.Errorf("tokens differ from Tokenize\ngot:  %v\nwant: %v", tokens, expectedTokens)
+				}
+
+				if !reflect.DeepEqual(diagnostics, expectedDiagnostics) {
+					t.Errorf("diagnostics differ from Tokenize\ngot:  %v\nwant: %v", diagnostics, expectedDiagnostics)
+				}
+			})
+		}
+	}
+}
+
+// Display math spanning lines is one block, whichever line its closing delimiter is read with
+func TestTokenizeReaderMathBlock(t *testing.T) {
+	for _, name := range []string{"math block", "math block over a list"} {
+		tokens, _ := collectStream(t, iotest.OneByteReader(strings.NewReader(streamDocuments[name])))
+
+		mathBlocks := 0
+		for _, token := range tokens {
+			if token.Kind == MATH_BLOCK {
+				mathBlocks++
+			}
+		}
+
+		if mathBlocks != 1 {
+			t.Errorf("%s: got %d math blocks, want 1\ntokens: %v", name, mathBlocks, tokens)
+		}
+	}
+}
+
+// An unclosed $$ is text, it continues the paragraph before it
+func TestUnclosedMathBlock(t *testing.T) {
+	for _, name := range []string{"unclosed math block", "unclosed math block without line break"} {
+		tokens, _ := collectStream(t, iotest.OneByteReader(strings.NewReader(streamDocuments[name])))
+
+		if len(tokens) != 2 || tokens[0].Kind != PARAGRAPH || !strings.Contains(tokens[0].Values[0], "$$") {
+			t.Errorf("%s: want a single paragraph with the delimiter\ntokens: %v", name, tokens)
+		}
+	}
+}
+
+// The time per line should stay the same as the document grows
+func BenchmarkTokenize(b *testing.B) {
+	for _, document := range benchmarkDocuments() {
+		b.Run(document.name, func(b *testing.B) {
+			b.SetBytes(int64(len(document.source)))
+
+			for range b.N {
+				if _, err := Tokenize(document.source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Reads of a single byte, as from a slow pipe, tokenize the last block again after each line
+func BenchmarkTokenizeReader(b *testing.B) {
+	for _, sections := range []int{100, 400, 1600} {
+		source := generateDocument(sections)
+
+		b.Run(fmt.Sprintf("lines=%d", strings.Count(source, "\n")), func(b *testing.B) {
+			b.SetBytes(int64(len(source)))
+
+			for range b.N {
+				for _, err := range TokenizeReader(iotest.OneByteReader(strings.NewReader(source))) {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// The time per byte should stay the same for long lines and documents without headings too
+func BenchmarkParseAST(b *testing.B) {
+	for _, document := range benchmarkDocuments() {
+		b.Run(document.name, func(b *testing.B) {
+			b.SetBytes(int64(len(document.source)))
+
+			for range b.N {
+				if _, err := ParseAST(document.source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// References without definition are text, they are reported without stopping the note from rendering
+func TestUndefinedLinkReference(t *testing.T) {
+	tree, err := ParseAST("---\nid: x\n---\nmatrix[0][1] and a[i][] or [j]\n")
+
+	diagnostics, _ := err.(Diagnostics)
+	if len(diagnostics) != 2 || diagnostics.HasErrors() {
+		t.Fatalf("want 2 warnings, got: %v", err)
+	}
+
+	values := tree.Children[0].Values
+	if len(values) != 1 || values[0].Self.Kind != TEXT || values[0].Self.Values[0] != "matrix[0][1] and a[i][] or [j]" {
+		var str string
+		tree.Display(&str, 0)
+		t.Errorf("want the paragraph as text, got:\n%s", str)
+	}
+}
+
+// Snippets of long lines are cut around the caret
+func TestDiagnosticSnippetOfLongLine(t *testing.T) {
+	line := strings.Repeat("é ", 100) + "a[b][c]" + strings.Repeat(" x", 100)
+	_, err := ParseAST("---\nid: x\n---\n" + line + "\n")
+
+	diagnostics, _ := err.(Diagnostics)
+	if len(diagnostics) != 1 {
+		t.Fatalf("want 1 warning, got: %v", err)
+	}
+
+	snippet := strings.Split(diagnostics[0].Snippet, "\n")
+	if len(snippet[0]) > 2*SNIPPET_CONTEXT+6 || !strings.HasPrefix(snippet[0], "...") || !strings.HasSuffix(snippet[0], "...") {
+		t.Errorf("want the line cut around the caret, got: %q", snippet[0])
+	}
+
+	caret := utf8.RuneCountInString(snippet[1]) - 1
+	if got := string([]rune(snippet[0])[caret:]); !strings.HasPrefix(got, "[b][c]") {
+		t.Errorf("want the caret under the reference, got it under: %q", got)
+	}
+}
+
+// URLs in the text of a link stay text, a link can't contain another link
+func TestLinkTextWithURL(t *testing.T) {
+	for _, source := range []string{
+		"[https://example.com/x](https://example.com/x)",
+		"[**<https://example.com/x>**](https://example.com/x)",
+		"[https://example.com/x][ref]\n\n[ref]: https://example.com/x",
+	} {
+		tokens, err := Tokenize(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		links := 0
+		for _, token := range tokens {
+			if token.Kind == LINK || token.Kind == LINK_REF {
+				links++
+			}
+		}
+
+		if links != 1 {
+			t.Errorf("%q: got %d links, want 1\ntokens: %v", source, links, tokens)
+		}
+	}
+}
+
+// Emphasis continues on the next line of the paragraph, including the lazy lines of quotes
+func TestEmphasisAcrossLines(t *testing.T) {
+	for source, kind := range map[string]TokenKind{
+		"**multi\nline bold**":                     BOLD_TEXT,
+		"_multi\nline italic_":                     ITALIC_TEXT,
+		"~~multi\nline strikethrough~~":            STRIKETHROUGH,
+		"> and **closed\nlater** on":               BOLD_TEXT,
+		streamDocuments["lazy quote continuation"]: BOLD_TEXT,
+	} {
+		tokens, err := Tokenize(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.ContainsFunc(tokens, func(token Token) bool { return token.Kind == kind }) {
+			t.Errorf("%q: no %v token\ntokens: %v", source, kind, tokens)
+		}
+	}
+}
+
+// A blank line ends the paragraph and the emphasis with it
+func TestEmphasisEndsWithParagraph(t *testing.T) {
+	tokens, err := Tokenize("**not\n\nbold**")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.ContainsFunc(tokens, func(token Token) bool { return token.Kind == BOLD_TEXT }) {
+		t.Errorf("bold text across paragraphs\ntokens: %v", tokens)
+	}
+}
+
+// Kinds of the inline tokens of a single paragraph, in order
+func inlineKinds(t *testing.T, source string) []TokenKind {
+	tokens, err := Tokenize(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := []TokenKind{}
+	for _, token := range tokens[1:] {
+		kinds = append(kinds, token.Kind)
+	}
+
+	return kinds
+}
+
+func TestAsteriskEmphasis(t *testing.T) {
+	for source, kinds := range map[string][]TokenKind{
+		"*italic*":               {ITALIC_TEXT, TEXT},
+		"in*side*word":           {TEXT, ITALIC_TEXT, TEXT, TEXT},
+		"***both***":             {BOLD_TEXT, ITALIC_TEXT, TEXT},
+		"***italic* in bold**":   {BOLD_TEXT, ITALIC_TEXT, TEXT, TEXT},
+		"***bold** in italic*":   {ITALIC_TEXT, BOLD_TEXT, TEXT, TEXT},
+		"*italic with **bold***": {ITALIC_TEXT, TEXT, BOLD_TEXT, TEXT},
+		"2 * 3 * 4":              {TEXT},
+	} {
+		if got := inlineKinds(t, source); !reflect.DeepEqual(got, kinds) {
+			t.Errorf("%q: got %v, want %v", source, got, kinds)
+		}
+	}
+}
+
+// The last line of an unclosed code block is code, even when it starts with the fence
+func TestUnclosedCodeBlock(t *testing.T) {
+	for source, expected := range map[string]struct {
+		code   string
+		closed bool
+	}{
+		"```\nfoo\n```js":      {"foo\n```js", false},
+		"````\nfoo\n````x":     {"foo\n````x", false},
+		"```\nfoo\n```` x":     {"foo\n```` x", false},
+		"```\nfoo\n````":       {"foo", true},
+		"````\nfoo\n```\n````": {"foo\n```", true},
+	} {
+		tokens, err := Tokenize(source)
+
+		diagnostics, _ := err.(Diagnostics)
+		if expected.closed != (len(diagnostics) == 0) {
+			t.Errorf("%q: got diagnostics %v", source, err)
+		}
+
+		if tokens[0].Kind != CODE_BLOCK || tokens[0].Values[1] != expected.code {
+			t.Errorf("%q: got %v, want code %q", source, tokens[0], expected.code)
+		}
+	}
+}
+
+// Delimiters left unclosed don't stop the ones after them from being closed
+func TestUnclosedEmphasis(t *testing.T) {
+	for source, kinds := range map[string][]TokenKind{
+		"_a *b _c *d*": {TEXT, ITALIC_TEXT, TEXT},
+		"*a **b** _c_": {TEXT, BOLD_TEXT, TEXT, TEXT, ITALIC_TEXT, TEXT},
+		"~~a ==b== c":  {TEXT, HIGHLIGHT, TEXT, TEXT},
+		"_a `_` b *c*": {TEXT, INLINE_CODE, TEXT, ITALIC_TEXT, TEXT},
+	} {
+		if got := inlineKinds(t, source); !reflect.DeepEqual(got, kinds) {
+			t.Errorf("%q: got %v, want %v", source, got, kinds)
+		}
+	}
+}
+
+func TestEmphasisSkipsInlineElements(t *testing.T) {
+	for source, kinds := range map[string][]TokenKind{
+		"**bold _it [**l**](https://x.com)_**": {BOLD_TEXT, TEXT, ITALIC_TEXT, TEXT, LINK, BOLD_TEXT, TEXT},
+		"**x [**y**](u)**":                     {BOLD_TEXT, TEXT, LINK, BOLD_TEXT, TEXT},
+		"**use `a**b` here**":                  {BOLD_TEXT, TEXT, INLINE_CODE, TEXT},
+		"**see [a](https://x.com/**y)**":       {BOLD_TEXT, TEXT, LINK, TEXT},
+		"**see <https://x.com/**y>**":          {BOLD_TEXT, TEXT, LINK},
+		"==a `==` b==":                         {HIGHLIGHT, TEXT, INLINE_CODE, TEXT},
+		"~~a [~~](u) b~~":                      {STRIKETHROUGH, TEXT, LINK, TEXT, TEXT},
+		"*a `*` b*":                            {ITALIC_TEXT, TEXT, INLINE_CODE, TEXT},
+	} {
+		if got := inlineKinds(t, source); !reflect.DeepEqual(got, kinds) {
+			t.Errorf("%q: got %v, want %v", source, got, kinds)
+		}
+	}
+}
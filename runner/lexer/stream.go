@@ -0,0 +1,137 @@
+package lexer
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"strings"
+)
+
+// Size of each read from the reader
+const STREAM_CHUNK_SIZE = 64 * 1024
+
+// The state of the lexer before a step, the tokens and diagnostics before it are kept
+type checkpoint struct {
+	pos         int
+	tokens      int
+	diagnostics int
+}
+
+func (lex *lexer) checkpoint() checkpoint {
+	return checkpoint{lex.pos, len(lex.tokens), len(lex.diagnostics)}
+}
+
+// The part of the document read but not tokenized yet, always starting at a line
+type tokenStream struct {
+	buffer []byte
+	start  Position
+}
+
+// Split the document read from the reader into tokens, each yielded once the block it
+// belongs to can't be changed by the rest of the document. The problems found are yielded
+// as Diagnostic errors after the tokens of their blocks, an error of the reader ends the iteration
+func TokenizeReader(reader io.Reader) iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		stream := &tokenStream{}
+		chunk := make([]byte, STREAM_CHUNK_SIZE)
+		// A block not complete yet is tokenized again once the buffer has doubled,
+		// so a long block is tokenized a number of times logarithmic to its length
+		needed := 0
+
+		for {
+			n, err := reader.Read(chunk)
+			stream.buffer = append(stream.buffer, chunk[:n]...)
+
+			if err == io.EOF {
+				stream.tokenize(len(stream.buffer), true, yield)
+				return
+			}
+
+			if err != nil {
+				yield(Token{}, err)
+				return
+			}
+
+			// Only whole lines are tokenized until the end of the document
+			end := bytes.LastIndexByte(stream.buffer, '\n') + 1
+			if end == 0 || end < needed {
+				continue
+			}
+
+			completed, ok := stream.tokenize(end, false, yield)
+			if !ok {
+				return
+			}
+
+			needed = 0
+			if !completed {
+				needed = 2 * end
+			}
+		}
+	}
+}
+
+// Tokenize the buffer up to the end and yield the tokens of the complete blocks, only the
+// blocks before the last one starting on a new line are complete until the end of the document.
+// Report if any block was complete and if the iteration should go on
+func (stream *tokenStream) tokenize(end int, final bool, yield func(Token, error) bool) (bool, bool) {
+	source := string(stream.buffer[:end])
+
+	constructors := blockConstructors()
+	if stream.start.Offset == 0 {
+		constructors = append([]patternConstructor{{frontmatterMatch, frontmatterHandler}}, constructors...)
+	}
+
+	lex := NewLexer(source, constructors)
+	lex.partial = !final
+	complete := checkpoint{}
+
+	for !lex.at_eof() {
+		// Elements continuing on the same line belong to the block before them, nothing is
+		// complete past a block waiting for the rest of the document
+		if lex.pos > 0 && lex.isOnNewLine() && !lex.pending {
+			complete = lex.checkpoint()
+		}
+
+		lex.next()
+	}
+
+	if final {
+		// Unclosed frontmatter is matched past the end of the source
+		complete = checkpoint{len(source), len(lex.tokens), len(lex.diagnostics)}
+	}
+
+	if complete.pos == 0 {
+		return false, true
+	}
+
+	index := newLineIndex(source, stream.start)
+
+	for _, token := range lex.tokens[:complete.tokens] {
+		token.Loc = Location{
+			Start: index.position(token.Loc.Start.Offset),
+			End:   index.position(token.Loc.End.Offset),
+		}
+
+		if !yield(token, nil) {
+			return true, false
+		}
+	}
+
+	diagnostics := lex.diagnostics[:complete.diagnostics]
+	locateDiagnostics(diagnostics, index)
+
+	for _, diagnostic := range diagnostics {
+		if !yield(Token{}, diagnostic) {
+			return true, false
+		}
+	}
+
+	stream.buffer = append(stream.buffer[:0], stream.buffer[complete.pos:]...)
+	stream.start = Position{
+		Offset: stream.start.Offset + complete.pos,
+		Line:   stream.start.Line + strings.Count(source[:complete.pos], "\n"),
+	}
+
+	return true, true
+}
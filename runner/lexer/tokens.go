@@ -15,25 +15,46 @@ const (
 	HEADING_3
 	HEADING_4
 	HEADING_5
+	HEADING_6
 
-	CALLOUT_NOTE
-	CALLOUT_IMPORTANT
-	CALLOUT_WARNING
-	CALLOUT_EXAMPLE
+	CALLOUT
 
 	QUOTE
 
+	LIST
 	HYPHEN_LIST
+	TASK_LIST
 	NUMBERED_LIST
 	CODE_BLOCK
+	MATH_BLOCK
+	HORIZONTAL_RULE
+
+	TABLE
+	TABLE_ROW
+	TABLE_CELL
+
+	FOOTNOTE_DEF
+	FOOTNOTES
+	LINK_DEF
+	EMBED
 
 	PARAGRAPH
 
 	TEXT
 	LINK
+	LINK_REF
+	WIKILINK
+	IMAGE
+	FOOTNOTE_REF
 	INLINE_CODE
+	MATH_INLINE
 	BOLD_TEXT
 	ITALIC_TEXT
+	STRIKETHROUGH
+	HIGHLIGHT
+	BLOCK_ID
+	HARD_BREAK
+	SHORTCODE
 )
 
 func getString(vals []string) string {
@@ -60,20 +81,31 @@ func getString(vals []string) string {
 	return str
 }
 
+// Position in the source, the offset is in bytes while the column is in runes,
+// lines and columns start from 0
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// The end is right after the last character, so source[Start.Offset:End.Offset]
+// is the text of the token
 type Location struct {
-	start [2]int
-	end   [2]int
+	Start Position
+	End   Position
 }
 
-func NewLoc(start, end [2]int) Location {
+// Create the location from the offsets, the lines and columns are filled in by Tokenize
+func NewLoc(start, end int) Location {
 	return Location{
-		start: start,
-		end:   end,
+		Start: Position{Offset: start},
+		End:   Position{Offset: end},
 	}
 }
 
 func (loc Location) Display() string {
-	return fmt.Sprintf("    [%d,%d] - [%d,%d]", loc.start[0], loc.start[1], loc.end[0], loc.end[1])
+	return fmt.Sprintf("    [%d,%d] - [%d,%d]", loc.Start.Line, loc.Start.Column, loc.End.Line, loc.End.Column)
 }
 
 type Token struct {
@@ -102,25 +134,41 @@ func (token Token) isOneOfKinds(kinds ...TokenKind) bool {
 
 // Calculate the length of indentation
 func (token Token) Indentation() int {
-	return token.Loc.start[1]
+	return token.Loc.Start.Column
 }
 
 func (token Token) Debug() string {
 	locDisplay := fmt.Sprintf("%s", token.Loc.Display())
 
 	if token.isOneOfKinds(
+		LIST,
 		NUMBERED_LIST,
+		TASK_LIST,
 		LINK,
+		IMAGE,
 		INLINE_CODE,
 		BOLD_TEXT,
 		ITALIC_TEXT,
+		STRIKETHROUGH,
+		HIGHLIGHT,
 		CODE_BLOCK,
-		FRONTMATTER,
+		MATH_BLOCK,
+		MATH_INLINE,
+		TABLE,
+		TABLE_ROW,
+		TABLE_CELL,
+		FOOTNOTE_DEF,
+		FOOTNOTE_REF,
+		LINK_DEF,
+		LINK_REF,
+		WIKILINK,
+		EMBED,
+		CALLOUT,
+		BLOCK_ID,
+		SHORTCODE,
 		TEXT,
 	) {
 		return fmt.Sprintf("%s (%s)", TokenKindString(token.Kind), getString(token.Values)) + locDisplay
-	} else if token.isOneOfKinds(FRONTMATTER) {
-		return fmt.Sprintf("%s ()", TokenKindString(token.Kind))
 	} else {
 		return fmt.Sprintf("%s ()", TokenKindString(token.Kind)) + locDisplay
 	}
@@ -130,14 +178,8 @@ func TokenKindString(kind TokenKind) string {
 	switch kind {
 	case FRONTMATTER:
 		return "frontmatter"
-	case CALLOUT_NOTE:
-		return "callout_note"
-	case CALLOUT_IMPORTANT:
-		return "callout_important"
-	case CALLOUT_WARNING:
-		return "callout_warning"
-	case CALLOUT_EXAMPLE:
-		return "callout_example"
+	case CALLOUT:
+		return "callout"
 	case QUOTE:
 		return "quote"
 	case PARAGRAPH:
@@ -146,12 +188,18 @@ func TokenKindString(kind TokenKind) string {
 		return "text"
 	case LINK:
 		return "link"
+	case IMAGE:
+		return "image"
 	case INLINE_CODE:
 		return "inline_code"
 	case BOLD_TEXT:
 		return "bold text"
 	case ITALIC_TEXT:
 		return "italic text"
+	case STRIKETHROUGH:
+		return "strikethrough"
+	case HIGHLIGHT:
+		return "highlight"
 	case HEADING_1:
 		return "heading_1"
 	case HEADING_2:
@@ -162,12 +210,50 @@ func TokenKindString(kind TokenKind) string {
 		return "heading_4"
 	case HEADING_5:
 		return "heading_5"
+	case HEADING_6:
+		return "heading_6"
+	case LIST:
+		return "list"
 	case HYPHEN_LIST:
 		return "hyphen_list"
+	case TASK_LIST:
+		return "task_list"
 	case NUMBERED_LIST:
 		return "numbered_list"
 	case CODE_BLOCK:
 		return "code_block"
+	case MATH_BLOCK:
+		return "math_block"
+	case MATH_INLINE:
+		return "math_inline"
+	case HORIZONTAL_RULE:
+		return "horizontal_rule"
+	case TABLE:
+		return "table"
+	case TABLE_ROW:
+		return "table_row"
+	case TABLE_CELL:
+		return "table_cell"
+	case FOOTNOTE_DEF:
+		return "footnote_def"
+	case FOOTNOTES:
+		return "footnotes"
+	case FOOTNOTE_REF:
+		return "footnote_ref"
+	case LINK_DEF:
+		return "link_def"
+	case LINK_REF:
+		return "link_ref"
+	case WIKILINK:
+		return "wikilink"
+	case EMBED:
+		return "embed"
+	case BLOCK_ID:
+		return "block_id"
+	case HARD_BREAK:
+		return "hard_break"
+	case SHORTCODE:
+		return "shortcode"
 	default:
 		return ""
 	}
@@ -8,6 +8,7 @@ import (
 	"html/template"
 	"net/http"
 	"os"
+	"path"
 	"time"
 
 	"github.com/leminhnguyenai/personal-blog/runner/asciitree"
@@ -23,10 +24,17 @@ type Data struct {
 }
 
 func Preview(e *Engine, filePath string) error {
+	// Wiki links and embeds are resolved against the notes next to the previewed one
+	_, _, notes, err := registerNotes(path.Dir(filePath))
+	if err != nil {
+		return err
+	}
+
 	mux := http.NewServeMux()
 
 	mux.Handle("GET /static/", FileServer("static"))
-	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("GET /{asset...}", AssetServer(path.Dir(filePath), path.Dir(filePath)))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		e.debug("Connected\n")
 		w.Header().Add("Cache-Control", "public, max-age=31536000")
 
@@ -37,8 +45,7 @@ func Preview(e *Engine, filePath string) error {
 		}
 
 		astTree, err := lexer.ParseAST(string(data))
-		if err != nil {
-			HandleError(w, err)
+		if !e.handleDiagnostics(w, filePath, err) {
 			return
 		}
 
@@ -54,10 +61,18 @@ func Preview(e *Engine, filePath string) error {
 			HandleError(w, err)
 			return
 		}
+		mdRenderer.SetNoteResolver(notes)
+		mdRenderer.SetCurrentNote(filePath)
 		writer := &renderer.Writer{}
 
 		content := mdRenderer.Render(astTree)
 
+		if !e.handleRenderErrors(w, filePath, mdRenderer.Errors()) {
+			return
+		}
+
+		e.handleDiagnostics(w, filePath, mdRenderer.Warnings())
+
 		templ, err := template.New("").Funcs(renderer.FuncsMap).ParseFiles("templates/index.html")
 		if err != nil {
 			HandleError(w, err)
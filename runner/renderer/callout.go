@@ -0,0 +1,91 @@
+package renderer
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/leminhnguyenai/personal-blog/runner/lexer"
+)
+
+type CalloutType struct {
+	// Nerd Font glyph shown before the title
+	Icon string
+	// Tailwind classes of the title and the box, written in full so Tailwind can find them
+	Text string
+	Box  string
+}
+
+var (
+	noteCallout      = CalloutType{"\U000F03EB", "text-aqua", "bg-aqua/10 outline-aqua"}
+	abstractCallout  = CalloutType{"\U000F0147", "text-code-blue", "bg-code-blue/10 outline-code-blue"}
+	infoCallout      = CalloutType{"\U000F02FC", "text-code-blue", "bg-code-blue/10 outline-code-blue"}
+	todoCallout      = CalloutType{"\U000F05E1", "text-code-blue", "bg-code-blue/10 outline-code-blue"}
+	tipCallout       = CalloutType{"\U000F0238", "text-code-lime", "bg-code-lime/10 outline-code-lime"}
+	importantCallout = CalloutType{"\U000F04CE", "text-code-purple", "bg-code-purple/10 outline-code-purple"}
+	successCallout   = CalloutType{"\U000F012C", "text-code-green", "bg-code-green/10 outline-code-green"}
+	questionCallout  = CalloutType{"\U000F02D7", "text-code-orange", "bg-code-orange/10 outline-code-orange"}
+	warningCallout   = CalloutType{"\U000F0026", "text-warning-yellow", "bg-warning-yellow/10 outline-warning-yellow"}
+	failureCallout   = CalloutType{"\U000F0156", "text-coral-pink", "bg-coral-pink/10 outline-coral-pink"}
+	dangerCallout    = CalloutType{"\U000F140B", "text-code-red", "bg-code-red/10 outline-code-red"}
+	bugCallout       = CalloutType{"\U000F00E4", "text-code-red", "bg-code-red/10 outline-code-red"}
+	exampleCallout   = CalloutType{"\U000F0279", "text-tmux-lavender", "bg-tmux-lavender/10 outline-tmux-lavender"}
+	quoteCallout     = CalloutType{"\U000F027E", "text-silver", "bg-silver/10 outline-silver"}
+)
+
+// Callout types by their lowercase name, aliases share the same type.
+// Add entries to support custom callouts, unknown types are rendered as notes
+var CalloutTypes = map[string]CalloutType{
+	"note":      noteCallout,
+	"abstract":  abstractCallout,
+	"summary":   abstractCallout,
+	"tldr":      abstractCallout,
+	"info":      infoCallout,
+	"todo":      todoCallout,
+	"tip":       tipCallout,
+	"hint":      tipCallout,
+	"important": importantCallout,
+	"success":   successCallout,
+	"check":     successCallout,
+	"done":      successCallout,
+	"question":  questionCallout,
+	"help":      questionCallout,
+	"faq":       questionCallout,
+	"warning":   warningCallout,
+	"caution":   warningCallout,
+	"attention": warningCallout,
+	"failure":   failureCallout,
+	"fail":      failureCallout,
+	"missing":   failureCallout,
+	"danger":    dangerCallout,
+	"error":     dangerCallout,
+	"bug":       bugCallout,
+	"example":   exampleCallout,
+	"quote":     quoteCallout,
+	"cite":      quoteCallout,
+}
+
+func (r *Renderer) calloutRenderer(node *lexer.Node) string {
+	name, fold := node.Self.Values[0], node.Self.Values[1]
+	title, children := r.Traverse(node)
+
+	calloutType, ok := CalloutTypes[name]
+	if !ok {
+		calloutType = CalloutTypes["note"]
+	}
+
+	// Without a custom title, the type is used as the title
+	if title == "" {
+		title = template.HTMLEscapeString(strings.ToUpper(name[:1]) + strings.ReplaceAll(name[1:], "-", " "))
+	}
+
+	r.templates.ExecuteTemplate(r.writer, "callout", struct {
+		Id       string
+		Type     CalloutType
+		Title    template.HTML
+		Foldable bool
+		Open     bool
+		Children template.HTML
+	}{r.blockIds[node], calloutType, template.HTML(title), fold != "", fold == "+", template.HTML(children)})
+
+	return r.writer.String()
+}
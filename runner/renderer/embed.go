@@ -0,0 +1,214 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/leminhnguyenai/personal-blog/runner/lexer"
+)
+
+// The maximum number of notes being embedded inside each other
+const maxEmbedDepth = 5
+
+func (r *Renderer) embedRenderer(node *lexer.Node) string {
+	note, heading, alias := node.Self.Values[0], node.Self.Values[1], node.Self.Values[2]
+
+	// Obsidian uses the same syntax to embed attachments, e.g. ![[diagram.png]]
+	if ext := path.Ext(note); ext != "" && ext != ".md" {
+		r.templates.ExecuteTemplate(r.writer, "image", struct {
+			Alt   string
+			Src   string
+			Title string
+		}{alias, imageSource(note), ""})
+
+		return r.writer.String()
+	}
+
+	source := note
+	if heading != "" {
+		source += "#" + heading
+	}
+
+	content, err := r.embedNote(note, heading)
+	if err != nil {
+		r.errs = append(r.errs, err)
+
+		r.templates.ExecuteTemplate(r.writer, "embed-error", struct {
+			Source string
+			Error  string
+		}{source, err.Error()})
+
+		return r.writer.String()
+	}
+
+	link := ""
+	if r.notes != nil {
+		link, _ = r.notes.Resolve(note)
+	}
+	if link != "" && heading != "" {
+		link += "#" + anchor(heading)
+	}
+
+	title := alias
+	if title == "" {
+		title = strings.Replace(source, "#", " > ", 1)
+	}
+
+	r.templates.ExecuteTemplate(r.writer, "embed", struct {
+		Id      string
+		Link    string
+		Title   string
+		Content template.HTML
+	}{r.blockIds[node], link, title, template.HTML(content)})
+
+	return r.writer.String()
+}
+
+// Parse the embedded note and render either the whole note or the section under the heading
+func (r *Renderer) embedNote(note string, heading string) (string, error) {
+	if r.notes == nil {
+		return "", fmt.Errorf("%w: [[%s]]", ErrNoteNotFound, note)
+	}
+
+	file, err := r.notes.ResolveFile(note)
+	if errors.Is(err, ErrNoteNotFound) {
+		return "", err
+	} else if err != nil {
+		// Ambiguous notes are still embedded, but reported
+		r.errs = append(r.errs, err)
+	}
+
+	if slices.Contains(r.embedStack, file) {
+		return "", fmt.Errorf(
+			"Embed::error -> cycle detected: %s -> %s",
+			strings.Join(r.embedStack, " -> "), file,
+		)
+	}
+
+	if len(r.embedStack) > maxEmbedDepth {
+		return "", fmt.Errorf("Embed::error -> embeds are nested more than %d levels deep at %s", maxEmbedDepth, file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	// Warnings of the embedded note are left to its own page
+	astTree, err := lexer.ParseEmbeddedAST(string(data))
+	var diagnostics lexer.Diagnostics
+	if errors.As(err, &diagnostics) && diagnostics.HasErrors() {
+		return "", fmt.Errorf("Embed::error -> %w", diagnostics.InFile(file))
+	}
+
+	r.embedStack = append(r.embedStack, file)
+	defer func() { r.embedStack = r.embedStack[:len(r.embedStack)-1] }()
+
+	if heading == "" {
+		// Only the blocks are rendered, the frontmatter with its table of contents is left out
+		_, children := r.Traverse(&lexer.Node{
+			Self:     lexer.Token{Kind: lexer.PARAGRAPH},
+			Children: astTree.Children,
+		})
+		return children, nil
+	}
+
+	if strings.HasPrefix(heading, "^") {
+		block := findBlock(astTree, heading[1:])
+		if block == nil {
+			return "", fmt.Errorf("Embed::error -> block %q not found in %s", heading, file)
+		}
+
+		// List items are embedded inside a list of their own
+		if block.Parent.Self.Kind == lexer.LIST {
+			block = &lexer.Node{Self: block.Parent.Self, Children: []*lexer.Node{block}}
+		}
+
+		_, children := r.Traverse(&lexer.Node{
+			Self:     lexer.Token{Kind: lexer.PARAGRAPH},
+			Children: []*lexer.Node{block},
+		})
+		return children, nil
+	}
+
+	section := findHeading(astTree, slugify(heading))
+	if section == nil {
+		return "", fmt.Errorf("Embed::error -> heading %q not found in %s", heading, file)
+	}
+
+	return r.headingRenderer(section), nil
+}
+
+// Find the first heading with the given anchor, the heading contains its section
+func findHeading(node *lexer.Node, link string) *lexer.Node {
+	for _, child := range node.Children {
+		switch child.Self.Kind {
+		case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5,
+			lexer.HEADING_6:
+			if slugify(getPlainText(child)) == link {
+				return child
+			}
+		}
+
+		if heading := findHeading(child, link); heading != nil {
+			return heading
+		}
+	}
+
+	return nil
+}
+
+// Find the block marked with the block ID
+func findBlock(node *lexer.Node, id string) *lexer.Node {
+	for i, child := range node.Children {
+		for _, value := range child.Values {
+			if value.Self.Kind == lexer.BLOCK_ID && value.Self.Values[0] == id {
+				return markedBlock(node, i)
+			}
+		}
+
+		if block := findBlock(child, id); block != nil {
+			return block
+		}
+	}
+
+	return nil
+}
+
+// Map the blocks marked with block IDs to the ids of their elements, so links to
+// Note#^block-id land on the block
+func markBlocks(node *lexer.Node, ids map[*lexer.Node]string) {
+	for i, child := range node.Children {
+		for _, value := range child.Values {
+			if value.Self.Kind == lexer.BLOCK_ID {
+				ids[markedBlock(node, i)] = anchor("^" + value.Self.Values[0])
+			}
+		}
+
+		markBlocks(child, ids)
+	}
+}
+
+// Return the block marked by a block ID in the child of the node. An ID on its own line
+// marks the block before it, or the block containing it when there is none before
+func markedBlock(node *lexer.Node, i int) *lexer.Node {
+	if !isBlockIdLine(node.Children[i]) {
+		return node.Children[i]
+	}
+
+	if i > 0 {
+		return node.Children[i-1]
+	}
+
+	return node
+}
+
+// Check if the paragraph holds nothing but a block ID
+func isBlockIdLine(node *lexer.Node) bool {
+	return node.Self.Kind == lexer.PARAGRAPH && len(node.Values) == 1 && node.Values[0].Self.Kind == lexer.BLOCK_ID
+}
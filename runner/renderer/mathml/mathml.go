@@ -0,0 +1,543 @@
+// Package mathml converts a subset of TeX into MathML, so formulas are rendered
+// by the browser without any client-side javascript
+package mathml
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+type parser struct {
+	source  []rune
+	pos     int
+	display bool
+	// Font variant applied to the identifiers, e.g. \mathbb{R}
+	variant string
+}
+
+// Convert the TeX source into a <math> element, display mode is used for
+// formulas on their own line
+func Convert(tex string, display bool) (string, error) {
+	p := &parser{source: []rune(tex), display: display}
+
+	content, err := p.parseExpression()
+	if err != nil {
+		return "", err
+	}
+
+	if !p.atEOF() {
+		return "", p.errorf("unexpected %q", p.peekToken())
+	}
+
+	mode := "inline"
+	if display {
+		mode = "block"
+	}
+
+	return fmt.Sprintf(
+		`<math xmlns="http://www.w3.org/1998/Math/MathML" display="%s"><mrow>%s</mrow></math>`,
+		mode, content,
+	), nil
+}
+
+func (p *parser) errorf(format string, v ...any) error {
+	return fmt.Errorf("MathML::error -> %s at position %d", fmt.Sprintf(format, v...), p.pos)
+}
+
+func (p *parser) atEOF() bool {
+	return p.pos >= len(p.source)
+}
+
+func (p *parser) skipWhitespaces() {
+	for !p.atEOF() && unicode.IsSpace(p.source[p.pos]) {
+		p.pos++
+	}
+}
+
+// Return the next token without consuming it, commands are returned with the backslash
+func (p *parser) peekToken() string {
+	p.skipWhitespaces()
+
+	if p.atEOF() {
+		return ""
+	}
+
+	if p.source[p.pos] != '\\' || p.pos+1 >= len(p.source) {
+		return string(p.source[p.pos])
+	}
+
+	end := p.pos + 1
+	for end < len(p.source) && unicode.IsLetter(p.source[end]) && p.source[end] < unicode.MaxASCII {
+		end++
+	}
+
+	// Single character commands, e.g. \{ or \\
+	if end == p.pos+1 {
+		end++
+	}
+
+	return string(p.source[p.pos:end])
+}
+
+func (p *parser) nextToken() string {
+	token := p.peekToken()
+	p.pos += len([]rune(token))
+
+	return token
+}
+
+// Expressions end at the end of the input or before a token closing the current context
+func (p *parser) parseExpression() (string, error) {
+	content := ""
+
+	for {
+		switch p.peekToken() {
+		case "", "}", "&", `\\`, `\end`, `\right`:
+			return content, nil
+		}
+
+		term, err := p.parseTerm()
+		if err != nil {
+			return "", err
+		}
+
+		content += term
+	}
+}
+
+// A term is an atom with optional subscript and superscript
+func (p *parser) parseTerm() (string, error) {
+	base, hasLimits, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup string
+	hasSub, hasSup := false, false
+
+	for {
+		token := p.peekToken()
+		if token != "_" && token != "^" && token != "'" {
+			break
+		}
+
+		p.nextToken()
+
+		// Primes are superscripts, e.g. f'
+		if token == "'" {
+			sup += "<mo>′</mo>"
+			hasSup = true
+			continue
+		}
+
+		script, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+
+		if token == "_" {
+			if hasSub {
+				return "", p.errorf("double subscript")
+			}
+			sub, hasSub = script, true
+		} else {
+			if hasSup && !strings.HasSuffix(sup, "<mo>′</mo>") {
+				return "", p.errorf("double superscript")
+			}
+			sup, hasSup = sup+script, true
+		}
+	}
+
+	under, over, both := "msub", "msup", "msubsup"
+	if hasLimits && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+
+	switch {
+	case hasSub && hasSup:
+		return fmt.Sprintf("<%s>%s<mrow>%s</mrow><mrow>%s</mrow></%s>", both, base, sub, sup, both), nil
+	case hasSub:
+		return fmt.Sprintf("<%s>%s<mrow>%s</mrow></%s>", under, base, sub, under), nil
+	case hasSup:
+		return fmt.Sprintf("<%s>%s<mrow>%s</mrow></%s>", over, base, sup, over), nil
+	default:
+		return base, nil
+	}
+}
+
+// Arguments of commands and scripts are either a group or a single token
+func (p *parser) parseArgument() (string, error) {
+	token := p.peekToken()
+
+	switch {
+	case token == "":
+		return "", p.errorf("missing argument")
+	case token == "{":
+		return p.parseGroup()
+	case unicode.IsDigit([]rune(token)[0]):
+		p.nextToken()
+		return "<mn>" + token + "</mn>", nil
+	}
+
+	atom, _, err := p.parseAtom()
+
+	return atom, err
+}
+
+func (p *parser) parseGroup() (string, error) {
+	if p.nextToken() != "{" {
+		return "", p.errorf("expected {")
+	}
+
+	content, err := p.parseExpression()
+	if err != nil {
+		return "", err
+	}
+
+	if p.nextToken() != "}" {
+		return "", p.errorf("missing closing brace")
+	}
+
+	return "<mrow>" + content + "</mrow>", nil
+}
+
+// Read the raw content of a group, used for text and environment names
+func (p *parser) parseRawGroup() (string, error) {
+	if p.nextToken() != "{" {
+		return "", p.errorf("expected {")
+	}
+
+	start := p.pos
+	depth := 1
+
+	for ; !p.atEOF(); p.pos++ {
+		switch p.source[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+
+		if depth == 0 {
+			raw := string(p.source[start:p.pos])
+			p.pos++
+			return raw, nil
+		}
+	}
+
+	return "", p.errorf("missing closing brace")
+}
+
+func (p *parser) identifier(value string) string {
+	if p.variant != "" {
+		return fmt.Sprintf(`<mi mathvariant="%s">%s</mi>`, p.variant, html.EscapeString(value))
+	}
+
+	return "<mi>" + html.EscapeString(value) + "</mi>"
+}
+
+func operator(value string) string {
+	return "<mo>" + html.EscapeString(value) + "</mo>"
+}
+
+// Parse a single atom, the boolean tells if the scripts of the atom are placed as limits
+func (p *parser) parseAtom() (string, bool, error) {
+	token := p.peekToken()
+	char := []rune(token)[0]
+
+	switch {
+	case token == "{":
+		group, err := p.parseGroup()
+		return group, false, err
+	case token == "}":
+		return "", false, p.errorf("unexpected }")
+	case char == '\\':
+		return p.parseCommand()
+	case unicode.IsDigit(char) || char == '.':
+		return p.parseNumber(), false, nil
+	case unicode.IsLetter(char):
+		p.nextToken()
+		return p.identifier(token), false, nil
+	}
+
+	p.nextToken()
+
+	switch token {
+	case "-":
+		return operator("−"), false, nil
+	case "*":
+		return operator("∗"), false, nil
+	case "~":
+		return `<mspace width="0.3333em"/>`, false, nil
+	case "%", "#", "$":
+		return "", false, p.errorf("unsupported character %q", token)
+	default:
+		return operator(token), false, nil
+	}
+}
+
+func (p *parser) parseNumber() string {
+	start := p.pos
+
+	for !p.atEOF() && (unicode.IsDigit(p.source[p.pos]) || p.source[p.pos] == '.') {
+		p.pos++
+	}
+
+	return "<mn>" + string(p.source[start:p.pos]) + "</mn>"
+}
+
+func (p *parser) parseCommand() (string, bool, error) {
+	start := p.pos
+	command := p.nextToken()
+	name := command[1:]
+
+	if value, ok := greekLetters[name]; ok {
+		// Uppercase greek letters are upright
+		if unicode.IsUpper([]rune(value)[0]) {
+			return fmt.Sprintf(`<mi mathvariant="normal">%s</mi>`, value), false, nil
+		}
+		return p.identifier(value), false, nil
+	}
+
+	if value, ok := largeOperators[name]; ok {
+		return fmt.Sprintf(`<mo largeop="true">%s</mo>`, value), !integrals[name], nil
+	}
+
+	if value, ok := operators[name]; ok {
+		return operator(value), false, nil
+	}
+
+	if value, ok := identifiers[name]; ok {
+		return "<mi>" + html.EscapeString(value) + "</mi>", false, nil
+	}
+
+	if hasLimits, ok := functions[name]; ok {
+		return fmt.Sprintf(`<mi mathvariant="normal">%s</mi>`, name), hasLimits, nil
+	}
+
+	if width, ok := spaces[name]; ok {
+		return fmt.Sprintf(`<mspace width="%s"/>`, width), false, nil
+	}
+
+	if value, ok := accents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+
+		return fmt.Sprintf(`<mover accent="true"><mrow>%s</mrow><mo>%s</mo></mover>`, arg, value), false, nil
+	}
+
+	if variant, ok := fontVariants[name]; ok {
+		prevVariant := p.variant
+		p.variant = variant
+		arg, err := p.parseArgument()
+		p.variant = prevVariant
+
+		return arg, false, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "binom":
+		numerator, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+
+		denominator, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+
+		if name == "binom" {
+			return fmt.Sprintf(
+				`<mrow><mo>(</mo><mfrac linethickness="0">%s%s</mfrac><mo>)</mo></mrow>`,
+				numerator, denominator,
+			), false, nil
+		}
+
+		return fmt.Sprintf("<mfrac>%s%s</mfrac>", numerator, denominator), false, nil
+	case "sqrt":
+		// Optional index, e.g. \sqrt[3]{x}
+		if p.peekToken() == "[" {
+			p.nextToken()
+			index := ""
+
+			for p.peekToken() != "]" {
+				if p.peekToken() == "" {
+					return "", false, p.errorf("missing closing bracket")
+				}
+
+				term, err := p.parseTerm()
+				if err != nil {
+					return "", false, err
+				}
+				index += term
+			}
+			p.nextToken()
+
+			radicand, err := p.parseArgument()
+			if err != nil {
+				return "", false, err
+			}
+
+			return fmt.Sprintf("<mroot>%s<mrow>%s</mrow></mroot>", radicand, index), false, nil
+		}
+
+		radicand, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+
+		return fmt.Sprintf("<msqrt>%s</msqrt>", radicand), false, nil
+	case "text", "textrm", "mbox":
+		text, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+
+		return "<mtext>" + html.EscapeString(text) + "</mtext>", false, nil
+	case "operatorname":
+		text, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+
+		return fmt.Sprintf(`<mi mathvariant="normal">%s</mi>`, html.EscapeString(text)), false, nil
+	case "left":
+		return p.parseFenced()
+	case "begin":
+		return p.parseEnvironment()
+	case "right":
+		return "", false, p.errorf(`\right without \left`)
+	case "end":
+		return "", false, p.errorf(`\end without \begin`)
+	}
+
+	p.pos = start
+
+	return "", false, p.errorf("unsupported command %s", command)
+}
+
+// Read the delimiter following \left or \right, "." is an invisible delimiter
+func (p *parser) parseDelimiter() (string, error) {
+	token := p.nextToken()
+
+	switch {
+	case token == "":
+		return "", p.errorf("missing delimiter")
+	case token == ".":
+		return "", nil
+	case strings.HasPrefix(token, `\`):
+		value, ok := operators[token[1:]]
+		if !ok {
+			return "", p.errorf("unsupported delimiter %s", token)
+		}
+		return value, nil
+	}
+
+	return token, nil
+}
+
+func (p *parser) parseFenced() (string, bool, error) {
+	open, err := p.parseDelimiter()
+	if err != nil {
+		return "", false, err
+	}
+
+	content, err := p.parseExpression()
+	if err != nil {
+		return "", false, err
+	}
+
+	if p.nextToken() != `\right` {
+		return "", false, p.errorf(`missing \right`)
+	}
+
+	closing, err := p.parseDelimiter()
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf(
+		`<mrow><mo fence="true" stretchy="true">%s</mo>%s<mo fence="true" stretchy="true">%s</mo></mrow>`,
+		html.EscapeString(open), content, html.EscapeString(closing),
+	), false, nil
+}
+
+// Matrix-like environments, rows are separated by \\ and cells by &
+func (p *parser) parseEnvironment() (string, bool, error) {
+	name, err := p.parseRawGroup()
+	if err != nil {
+		return "", false, err
+	}
+
+	fences, ok := matrixFences[name]
+	if !ok {
+		return "", false, p.errorf("unsupported environment %s", name)
+	}
+
+	// The column specification of arrays is not used
+	if name == "array" {
+		if _, err := p.parseRawGroup(); err != nil {
+			return "", false, err
+		}
+	}
+
+	columnAlign := ""
+	switch name {
+	case "cases":
+		columnAlign = ` columnalign="left"`
+	case "aligned", "align*":
+		columnAlign = ` columnalign="right left"`
+	}
+
+	table := "<mtable" + columnAlign + "><mtr>"
+
+	for {
+		cell, err := p.parseExpression()
+		if err != nil {
+			return "", false, err
+		}
+
+		table += "<mtd>" + cell + "</mtd>"
+
+		switch p.nextToken() {
+		case "&":
+			continue
+		case `\\`:
+			table += "</mtr><mtr>"
+			continue
+		case `\end`:
+			endName, err := p.parseRawGroup()
+			if err != nil {
+				return "", false, err
+			}
+
+			if endName != name {
+				return "", false, p.errorf(`\begin{%s} ended by \end{%s}`, name, endName)
+			}
+		case "":
+			return "", false, p.errorf(`missing \end{%s}`, name)
+		default:
+			return "", false, p.errorf("unexpected token in %s", name)
+		}
+
+		break
+	}
+
+	table += "</mtr></mtable>"
+	// Trailing \\ create an empty row
+	table = strings.ReplaceAll(table, "<mtr><mtd></mtd></mtr>", "")
+
+	if fences[0] == "" && fences[1] == "" {
+		return table, false, nil
+	}
+
+	return fmt.Sprintf(
+		`<mrow><mo fence="true" stretchy="true">%s</mo>%s<mo fence="true" stretchy="true">%s</mo></mrow>`,
+		fences[0], table, fences[1],
+	), false, nil
+}
@@ -0,0 +1,86 @@
+package mathml
+
+import (
+	"strings"
+	"testing"
+)
+
+// Wrap the MathML of an expression the way Convert does for inline math
+func inlineMath(content string) string {
+	return `<math xmlns="http://www.w3.org/1998/Math/MathML" display="inline"><mrow>` + content + `</mrow></math>`
+}
+
+func TestConvert(t *testing.T) {
+	for tex, expected := range map[string]string{
+		// Fractions and roots
+		`\frac{a}{b}`: `<mfrac><mrow><mi>a</mi></mrow><mrow><mi>b</mi></mrow></mfrac>`,
+		`\sqrt{x}`:    `<msqrt><mrow><mi>x</mi></mrow></msqrt>`,
+
+		// Subscripts and superscripts
+		`x^2`:   `<msup><mi>x</mi><mrow><mn>2</mn></mrow></msup>`,
+		`x_i`:   `<msub><mi>x</mi><mrow><mi>i</mi></mrow></msub>`,
+		`x_i^2`: `<msubsup><mi>x</mi><mrow><mi>i</mi></mrow><mrow><mn>2</mn></mrow></msubsup>`,
+
+		// Greek letters, capitals are upright
+		`\alpha + \beta`: `<mi>α</mi><mo>+</mo><mi>β</mi>`,
+		`\Omega`:         `<mi mathvariant="normal">Ω</mi>`,
+
+		// Large operators take their limits as scripts
+		`\sum_{i=1}^{n} i`: `<msubsup><mo largeop="true">∑</mo><mrow><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow></mrow>` +
+			`<mrow><mrow><mi>n</mi></mrow></mrow></msubsup><mi>i</mi>`,
+
+		// Matrices
+		`\begin{matrix} a & b \\ c & d \end{matrix}`: `<mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr>` +
+			`<mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable>`,
+		`\begin{pmatrix} 1 & 0 \\ 0 & 1 \end{pmatrix}`: `<mrow><mo fence="true" stretchy="true">(</mo>` +
+			`<mtable><mtr><mtd><mn>1</mn></mtd><mtd><mn>0</mn></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mn>1</mn></mtd></mtr></mtable>` +
+			`<mo fence="true" stretchy="true">)</mo></mrow>`,
+
+		// Characters special to HTML are escaped
+		`a < b`:              `<mi>a</mi><mo>&lt;</mo><mi>b</mi>`,
+		`a > b`:              `<mi>a</mi><mo>&gt;</mo><mi>b</mi>`,
+		`\&`:                 `<mi>&amp;</mi>`,
+		`\text{a & b < c}`:   `<mtext>a &amp; b &lt; c</mtext>`,
+		`\operatorname{a<b}`: `<mi mathvariant="normal">a&lt;b</mi>`,
+	} {
+		got, err := Convert(tex, false)
+		if err != nil {
+			t.Errorf("%q: %v", tex, err)
+			continue
+		}
+
+		if got != inlineMath(expected) {
+			t.Errorf("%q:\ngot:  %s\nwant: %s", tex, got, inlineMath(expected))
+		}
+	}
+}
+
+func TestConvertDisplay(t *testing.T) {
+	got, err := Convert(`x`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(got, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`) {
+		t.Errorf("want display math as a block, got: %s", got)
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	for tex, message := range map[string]string{
+		`\foo`:     `unsupported command \foo`,
+		`\frac{a}`: "missing argument",
+		`{a`:       "missing closing brace",
+		`a & b`:    `unexpected "&"`,
+	} {
+		got, err := Convert(tex, false)
+		if err == nil {
+			t.Errorf("%q: want an error, got: %s", tex, got)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: got error %q, want %q", tex, err, message)
+		}
+	}
+}
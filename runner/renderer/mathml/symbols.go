@@ -0,0 +1,249 @@
+package mathml
+
+// Greek letters are identifiers, e.g. \alpha -> α
+var greekLetters = map[string]string{
+	"alpha":      "α",
+	"beta":       "β",
+	"gamma":      "γ",
+	"delta":      "δ",
+	"epsilon":    "ϵ",
+	"varepsilon": "ε",
+	"zeta":       "ζ",
+	"eta":        "η",
+	"theta":      "θ",
+	"vartheta":   "ϑ",
+	"iota":       "ι",
+	"kappa":      "κ",
+	"lambda":     "λ",
+	"mu":         "μ",
+	"nu":         "ν",
+	"xi":         "ξ",
+	"pi":         "π",
+	"varpi":      "ϖ",
+	"rho":        "ρ",
+	"varrho":     "ϱ",
+	"sigma":      "σ",
+	"varsigma":   "ς",
+	"tau":        "τ",
+	"upsilon":    "υ",
+	"phi":        "ϕ",
+	"varphi":     "φ",
+	"chi":        "χ",
+	"psi":        "ψ",
+	"omega":      "ω",
+	"Gamma":      "Γ",
+	"Delta":      "Δ",
+	"Theta":      "Θ",
+	"Lambda":     "Λ",
+	"Xi":         "Ξ",
+	"Pi":         "Π",
+	"Sigma":      "Σ",
+	"Upsilon":    "Υ",
+	"Phi":        "Φ",
+	"Psi":        "Ψ",
+	"Omega":      "Ω",
+}
+
+// Symbols rendered as operators, e.g. \leq -> ≤
+var operators = map[string]string{
+	"cdot":           "⋅",
+	"times":          "×",
+	"div":            "÷",
+	"pm":             "±",
+	"mp":             "∓",
+	"ast":            "∗",
+	"circ":           "∘",
+	"bullet":         "∙",
+	"leq":            "≤",
+	"le":             "≤",
+	"geq":            "≥",
+	"ge":             "≥",
+	"neq":            "≠",
+	"ne":             "≠",
+	"approx":         "≈",
+	"equiv":          "≡",
+	"sim":            "∼",
+	"simeq":          "≃",
+	"cong":           "≅",
+	"propto":         "∝",
+	"ll":             "≪",
+	"gg":             "≫",
+	"in":             "∈",
+	"notin":          "∉",
+	"ni":             "∋",
+	"subset":         "⊂",
+	"subseteq":       "⊆",
+	"supset":         "⊃",
+	"supseteq":       "⊇",
+	"cup":            "∪",
+	"cap":            "∩",
+	"setminus":       "∖",
+	"emptyset":       "∅",
+	"varnothing":     "∅",
+	"forall":         "∀",
+	"exists":         "∃",
+	"neg":            "¬",
+	"lnot":           "¬",
+	"land":           "∧",
+	"wedge":          "∧",
+	"lor":            "∨",
+	"vee":            "∨",
+	"oplus":          "⊕",
+	"otimes":         "⊗",
+	"to":             "→",
+	"rightarrow":     "→",
+	"leftarrow":      "←",
+	"gets":           "←",
+	"leftrightarrow": "↔",
+	"Rightarrow":     "⇒",
+	"implies":        "⇒",
+	"Leftarrow":      "⇐",
+	"Leftrightarrow": "⇔",
+	"iff":            "⇔",
+	"mapsto":         "↦",
+	"uparrow":        "↑",
+	"downarrow":      "↓",
+	"mid":            "∣",
+	"parallel":       "∥",
+	"perp":           "⊥",
+	"angle":          "∠",
+	"ldots":          "…",
+	"cdots":          "⋯",
+	"vdots":          "⋮",
+	"ddots":          "⋱",
+	"dots":           "…",
+	"prime":          "′",
+	"langle":         "⟨",
+	"rangle":         "⟩",
+	"lfloor":         "⌊",
+	"rfloor":         "⌋",
+	"lceil":          "⌈",
+	"rceil":          "⌉",
+	"vert":           "|",
+	"Vert":           "‖",
+	"{":              "{",
+	"}":              "}",
+	"|":              "‖",
+}
+
+// Symbols rendered as identifiers
+var identifiers = map[string]string{
+	"infty":   "∞",
+	"partial": "∂",
+	"nabla":   "∇",
+	"hbar":    "ℏ",
+	"ell":     "ℓ",
+	"Re":      "ℜ",
+	"Im":      "ℑ",
+	"aleph":   "ℵ",
+	"%":       "%",
+	"$":       "$",
+	"#":       "#",
+	"&":       "&",
+	"_":       "_",
+}
+
+// Large operators take their scripts as limits in display mode, except for integrals
+var largeOperators = map[string]string{
+	"sum":      "∑",
+	"prod":     "∏",
+	"coprod":   "∐",
+	"bigcup":   "⋃",
+	"bigcap":   "⋂",
+	"bigvee":   "⋁",
+	"bigwedge": "⋀",
+	"int":      "∫",
+	"iint":     "∬",
+	"iiint":    "∭",
+	"oint":     "∮",
+}
+
+var integrals = map[string]bool{
+	"int":   true,
+	"iint":  true,
+	"iiint": true,
+	"oint":  true,
+}
+
+// Named functions are upright identifiers, the value tells if they take limits
+var functions = map[string]bool{
+	"sin":    false,
+	"cos":    false,
+	"tan":    false,
+	"cot":    false,
+	"sec":    false,
+	"csc":    false,
+	"arcsin": false,
+	"arccos": false,
+	"arctan": false,
+	"sinh":   false,
+	"cosh":   false,
+	"tanh":   false,
+	"log":    false,
+	"ln":     false,
+	"lg":     false,
+	"exp":    false,
+	"arg":    false,
+	"deg":    false,
+	"dim":    false,
+	"ker":    false,
+	"hom":    false,
+	"det":    true,
+	"gcd":    true,
+	"lim":    true,
+	"liminf": true,
+	"limsup": true,
+	"max":    true,
+	"min":    true,
+	"sup":    true,
+	"inf":    true,
+	"Pr":     true,
+}
+
+// Accents placed over their argument, e.g. \hat{x}
+var accents = map[string]string{
+	"hat":       "^",
+	"widehat":   "^",
+	"bar":       "¯",
+	"overline":  "¯",
+	"vec":       "→",
+	"dot":       "˙",
+	"ddot":      "¨",
+	"tilde":     "~",
+	"widetilde": "~",
+}
+
+var fontVariants = map[string]string{
+	"mathbb":   "double-struck",
+	"mathbf":   "bold",
+	"mathit":   "italic",
+	"mathrm":   "normal",
+	"mathcal":  "script",
+	"mathfrak": "fraktur",
+	"mathsf":   "sans-serif",
+	"mathtt":   "monospace",
+}
+
+// Spacing commands in em
+var spaces = map[string]string{
+	",":     "0.1667em",
+	":":     "0.2222em",
+	";":     "0.2778em",
+	" ":     "0.3333em",
+	"quad":  "1em",
+	"qquad": "2em",
+}
+
+// Fences of matrix environments
+var matrixFences = map[string][2]string{
+	"matrix":  {"", ""},
+	"pmatrix": {"(", ")"},
+	"bmatrix": {"[", "]"},
+	"Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"},
+	"Vmatrix": {"‖", "‖"},
+	"cases":   {"{", ""},
+	"aligned": {"", ""},
+	"align*":  {"", ""},
+	"array":   {"", ""},
+}
@@ -2,15 +2,19 @@ package renderer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/url"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/leminhnguyenai/personal-blog/runner/apis"
 	"github.com/leminhnguyenai/personal-blog/runner/lexer"
+	"github.com/leminhnguyenai/personal-blog/runner/renderer/mathml"
 )
 
 type Writer struct {
@@ -32,6 +36,15 @@ func (w *Writer) String() string {
 type Renderer struct {
 	templates *template.Template
 	writer    *Writer
+	notes     *NoteResolver
+	// Files of the notes being rendered, the outermost note first
+	embedStack []string
+	// Problems that don't stop the rendering, e.g. ambiguous wiki links
+	errs []error
+	// Problems that are only reported, e.g. shortcodes without an emoji or a Nerd Font glyph
+	warnings lexer.Diagnostics
+	// Element ids of the blocks marked with block IDs in the note being rendered
+	blockIds map[*lexer.Node]string
 }
 
 func NewRenderer() (*Renderer, error) {
@@ -40,10 +53,54 @@ func NewRenderer() (*Renderer, error) {
 		return nil, err
 	}
 
-	return &Renderer{templates, &Writer{}}, nil
+	return &Renderer{templates: templates, writer: &Writer{}}, nil
+}
+
+// Set the resolver used for wiki links, without it every wiki link is rendered as broken
+func (r *Renderer) SetNoteResolver(notes *NoteResolver) {
+	r.notes = notes
+}
+
+// Set the file of the note being rendered, so embeds of the note itself are detected
+func (r *Renderer) SetCurrentNote(file string) {
+	r.embedStack = []string{file}
+}
+
+// Return the problems found during the rendering
+func (r *Renderer) Errors() []error {
+	return r.errs
+}
+
+// Return the warnings found during the rendering as Diagnostics, nil if there are none
+// so the result can be handled as the error of the parser
+func (r *Renderer) Warnings() error {
+	if len(r.warnings) == 0 {
+		return nil
+	}
+
+	return r.warnings
+}
+
+// Report a warning at the start of the node, nodes of embedded notes are reported in their own file
+func (r *Renderer) warn(node *lexer.Node, format string, args ...any) {
+	file := ""
+	if len(r.embedStack) > 1 {
+		file = r.embedStack[len(r.embedStack)-1]
+	}
+
+	r.warnings = append(r.warnings, lexer.Diagnostic{
+		Severity: lexer.SEVERITY_WARNING,
+		File:     file,
+		Line:     node.Self.Loc.Start.Line + 1,
+		Column:   node.Self.Loc.Start.Column + 1,
+		Message:  fmt.Sprintf(format, args...),
+	})
 }
 
 func (r *Renderer) Render(astTree *lexer.Node) string {
+	r.blockIds = map[*lexer.Node]string{}
+	markBlocks(astTree, r.blockIds)
+
 	values, children := r.Traverse(astTree)
 	content := values + children
 
@@ -55,7 +112,8 @@ func (r *Renderer) GenerateTOC(node *lexer.Node) string {
 
 	for _, child := range node.Children {
 		switch child.Self.Kind {
-		case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5:
+		case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5,
+			lexer.HEADING_6:
 			children += r.tocRenderer(child)
 		}
 	}
@@ -63,21 +121,44 @@ func (r *Renderer) GenerateTOC(node *lexer.Node) string {
 	return children
 }
 
+// Convert the text into the id used by heading anchors
+func slugify(str string) string {
+	return strings.Join(strings.Fields(strings.ToLower(str)), "-")
+}
+
+// Convert the heading or block ID of a wiki link into the id of the element, e.g. Note#^block-id
+func anchor(heading string) string {
+	if strings.HasPrefix(heading, "^") {
+		return heading
+	}
+
+	return slugify(heading)
+}
+
 // Get the string representation of the value in plain text
-func getStringRepresentation(node *lexer.Node) string {
+func getPlainText(node *lexer.Node) string {
 	values := ""
 	for _, value := range node.Values {
-		values += value.Self.Values[0]
+		switch {
+		// Line breaks of setext headings spanning lines
+		case value.Self.Kind == lexer.HARD_BREAK:
+			values += " "
+		// Nested inline elements are represented by their children
+		case len(value.Values) > 0:
+			values += getPlainText(value)
+		case len(value.Self.Values) > 0:
+			values += value.Self.Values[0]
+		}
 	}
 
-	return strings.ToLower(values)
+	return values
 }
 
 func (r *Renderer) tocRenderer(node *lexer.Node) string {
 	children := r.GenerateTOC(node)
-	strRepresentation := getStringRepresentation(node)
-	values, _ := r.Traverse(node)
-	link := strings.Replace(strRepresentation, " ", "-", -1)
+	// Only the heading text is needed, rendering the section would run embeds and previews again
+	values, _ := r.Traverse(&lexer.Node{Self: node.Self, Values: node.Values})
+	link := slugify(getPlainText(node))
 
 	r.templates.ExecuteTemplate(r.writer, "TOC", struct {
 		Type     int
@@ -87,7 +168,8 @@ func (r *Renderer) tocRenderer(node *lexer.Node) string {
 	}{int(node.Self.Kind), template.HTML(values), link, template.HTML(children)})
 
 	switch node.Parent.Self.Kind {
-	case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5:
+	case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5,
+		lexer.HEADING_6:
 		return r.writer.String()
 	default:
 		return "<ul>" + r.writer.String() + "</ul>"
@@ -108,26 +190,61 @@ func (r *Renderer) Traverse(node *lexer.Node) (string, string) {
 			values += r.defaultRenderer(value, "text")
 		case lexer.LINK:
 			values += r.linkRenderer(value)
+		case lexer.WIKILINK:
+			values += r.wikilinkRenderer(value)
+		case lexer.IMAGE:
+			values += r.imageRenderer(value)
+		case lexer.FOOTNOTE_REF:
+			values += r.footnoteRefRenderer(value)
 		case lexer.INLINE_CODE:
 			values += r.defaultRenderer(value, "inline-code")
+		case lexer.MATH_INLINE:
+			values += r.mathRenderer(value, false)
 		case lexer.BOLD_TEXT:
-			values += r.defaultRenderer(value, "bold-text")
+			values += r.inlineContainerRenderer(value, "bold-text")
 		case lexer.ITALIC_TEXT:
-			values += r.defaultRenderer(value, "italic-text")
+			values += r.inlineContainerRenderer(value, "italic-text")
+		case lexer.STRIKETHROUGH:
+			values += r.inlineContainerRenderer(value, "strikethrough")
+		case lexer.HIGHLIGHT:
+			values += r.inlineContainerRenderer(value, "highlight")
+		case lexer.BLOCK_ID:
+			// Block IDs are the ids of the blocks they mark
+		case lexer.HARD_BREAK:
+			r.templates.ExecuteTemplate(r.writer, "hard-break", nil)
+			values += r.writer.String()
+		case lexer.SHORTCODE:
+			values += r.shortcodeRenderer(value)
 		}
 	}
 
 	for _, child := range node.Children {
 		switch child.Self.Kind {
-		case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5:
+		case lexer.HEADING_1, lexer.HEADING_2, lexer.HEADING_3, lexer.HEADING_4, lexer.HEADING_5,
+			lexer.HEADING_6:
 			children += r.headingRenderer(child)
-		case lexer.HYPHEN_LIST, lexer.NUMBERED_LIST, lexer.PARAGRAPH:
+		case lexer.LIST:
 			children += r.listRenderer(child)
+		case lexer.PARAGRAPH:
+			// Block IDs on their own line mark the block before them
+			if !isBlockIdLine(child) {
+				children += r.paragraphRenderer(child)
+			}
 		case lexer.CODE_BLOCK:
 			children += r.codeBlockRenderer(child)
+		case lexer.MATH_BLOCK:
+			children += r.mathRenderer(child, true)
+		case lexer.TABLE:
+			children += r.tableRenderer(child)
+		case lexer.HORIZONTAL_RULE:
+			children += r.horizontalRuleRenderer()
+		case lexer.FOOTNOTES:
+			children += r.footnotesRenderer(child)
+		case lexer.EMBED:
+			children += r.embedRenderer(child)
 		case lexer.QUOTE:
 			children += r.quoteRenderer(child)
-		case lexer.CALLOUT_NOTE, lexer.CALLOUT_IMPORTANT, lexer.CALLOUT_WARNING, lexer.CALLOUT_EXAMPLE:
+		case lexer.CALLOUT:
 			children += r.calloutRenderer(child)
 		}
 	}
@@ -141,30 +258,54 @@ func (r *Renderer) defaultRenderer(node *lexer.Node, template string) string {
 	return r.writer.String()
 }
 
+// Render inline elements that wrap other inline elements, e.g. bold text containing a link
+func (r *Renderer) inlineContainerRenderer(node *lexer.Node, name string) string {
+	values, _ := r.Traverse(node)
+
+	r.templates.ExecuteTemplate(r.writer, name, struct{ Value template.HTML }{template.HTML(values)})
+
+	return r.writer.String()
+}
+
+// Count the completed and total task list items in the subtree
+func countTasks(node *lexer.Node) (int, int) {
+	done, total := 0, 0
+
+	for _, child := range node.Children {
+		if child.Self.Kind == lexer.TASK_LIST {
+			total++
+			if child.Self.Values[0] == "checked" {
+				done++
+			}
+		}
+
+		childDone, childTotal := countTasks(child)
+		done += childDone
+		total += childTotal
+	}
+
+	return done, total
+}
+
 func (r *Renderer) frontmatterRenderer(node *lexer.Node) string {
 	type Data struct {
-		Title string
-		Date  string
-		Tags  []string
-		TOC   template.HTML
-	}
-
-	data := Data{}
-
-	for i := 0; i < len(node.Self.Values); i += 2 {
-		propertyName := node.Self.Values[i]
-		propertyValue := node.Self.Values[i+1]
-		switch propertyName {
-		case "id":
-			data.Title = propertyValue
-		case "date":
-			data.Date = propertyValue
-		case "tags":
-			tags := strings.Split(propertyValue, ",")
-			data.Tags = tags[:len(tags)-1]
-		}
+		lexer.Frontmatter
+		TOC        template.HTML
+		TasksDone  int
+		TasksTotal int
+	}
+
+	// The problems of the frontmatter are reported when the note is parsed
+	frontmatter, _ := lexer.ParseFrontmatter(node.Self.Values[0])
+
+	// Notes without a title are named by their id
+	if frontmatter.Title == "" {
+		frontmatter.Title = frontmatter.ID
 	}
 
+	data := Data{Frontmatter: frontmatter}
+	data.TasksDone, data.TasksTotal = countTasks(node)
+
 	data.TOC = template.HTML(r.GenerateTOC(node))
 
 	r.templates.ExecuteTemplate(r.writer, "frontmatter", data)
@@ -173,8 +314,7 @@ func (r *Renderer) frontmatterRenderer(node *lexer.Node) string {
 
 func (r *Renderer) headingRenderer(node *lexer.Node) string {
 	values, children := r.Traverse(node)
-	strRepresentation := getStringRepresentation(node)
-	link := strings.Replace(strRepresentation, " ", "-", -1)
+	link := slugify(getPlainText(node))
 
 	r.templates.ExecuteTemplate(r.writer, "heading", struct {
 		Type     int
@@ -186,83 +326,210 @@ func (r *Renderer) headingRenderer(node *lexer.Node) string {
 	return r.writer.String()
 }
 
-// FIX: Adding approprite <ul> tags
 func (r *Renderer) listRenderer(node *lexer.Node) string {
+	ordered := node.Self.Values[0] == "ordered"
+	loose := node.Self.Values[2] == "loose"
+	start, _ := strconv.Atoi(node.Self.Values[1])
+
+	items := ""
+	for i, item := range node.Children {
+		items += r.listItemRenderer(item, start+i, loose)
+	}
+
+	r.templates.ExecuteTemplate(r.writer, "list", struct {
+		Id      string
+		Ordered bool
+		Start   int
+		Items   template.HTML
+	}{r.blockIds[node], ordered, start, template.HTML(items)})
+
+	return r.writer.String()
+}
+
+// Number is the position of the item in an ordered list, loose items are spaced apart
+func (r *Renderer) listItemRenderer(node *lexer.Node, number int, loose bool) string {
 	values, children := r.Traverse(node)
 
-	if node.Self.Kind == lexer.HYPHEN_LIST {
-		r.templates.ExecuteTemplate(r.writer, "hyphen-list", struct {
+	switch node.Self.Kind {
+	case lexer.TASK_LIST:
+		r.templates.ExecuteTemplate(r.writer, "task-list", struct {
+			Id       string
+			Checked  bool
+			Loose    bool
 			Values   template.HTML
 			Children template.HTML
-		}{template.HTML(values), template.HTML(children)})
-	} else if node.Self.Kind == lexer.NUMBERED_LIST {
+		}{r.blockIds[node], node.Self.Values[0] == "checked", loose, template.HTML(values), template.HTML(children)})
+	case lexer.NUMBERED_LIST:
+		marker := strings.TrimSpace(node.Self.Values[0])
+
 		r.templates.ExecuteTemplate(r.writer, "numbered-list", struct {
+			Id       string
 			Number   string
+			Loose    bool
 			Values   template.HTML
 			Children template.HTML
-		}{node.Self.Values[0], template.HTML(values), template.HTML(children)})
-	} else if node.Self.Kind == lexer.PARAGRAPH {
-		r.templates.ExecuteTemplate(r.writer, "paragraph", struct {
-			Number   string
+		}{r.blockIds[node], strconv.Itoa(number) + marker[len(marker)-1:], loose, template.HTML(values), template.HTML(children)})
+	default:
+		r.templates.ExecuteTemplate(r.writer, "hyphen-list", struct {
+			Id       string
+			Loose    bool
 			Values   template.HTML
 			Children template.HTML
-		}{node.Self.Values[0], template.HTML(values), template.HTML(children)})
+		}{r.blockIds[node], loose, template.HTML(values), template.HTML(children)})
 	}
 
-	switch node.Parent.Self.Kind {
-	case lexer.PARAGRAPH, lexer.HYPHEN_LIST, lexer.NUMBERED_LIST:
-		return r.writer.String()
-	default:
-		return "<ul>" + r.writer.String() + "</ul>"
-	}
+	return r.writer.String()
+}
+
+func (r *Renderer) paragraphRenderer(node *lexer.Node) string {
+	values, children := r.Traverse(node)
 
+	r.templates.ExecuteTemplate(r.writer, "paragraph", struct {
+		Id       string
+		Values   template.HTML
+		Children template.HTML
+	}{r.blockIds[node], template.HTML(values), template.HTML(children)})
+
+	return r.writer.String()
 }
 
 func (r *Renderer) quoteRenderer(node *lexer.Node) string {
 	_, children := r.Traverse(node)
 
-	r.templates.ExecuteTemplate(r.writer, "quote", struct{ Values template.HTML }{
-		template.HTML(children),
-	})
+	r.templates.ExecuteTemplate(r.writer, "quote", struct {
+		Id       string
+		Children template.HTML
+	}{r.blockIds[node], template.HTML(children)})
 
 	return r.writer.String()
 }
 
-func (r *Renderer) calloutRenderer(node *lexer.Node) string {
-	values, children := r.Traverse(node)
+func (r *Renderer) codeBlockRenderer(node *lexer.Node) string {
+	code := strings.Split(node.Self.Values[1], "\n")
 
-	if values == "" {
-		switch node.Self.Kind {
-		case lexer.CALLOUT_NOTE:
-			values = "Note"
-		case lexer.CALLOUT_IMPORTANT:
-			values = "Important"
-		case lexer.CALLOUT_WARNING:
-			values = "Warning"
-		case lexer.CALLOUT_EXAMPLE:
-			values = "Example"
-		}
+	r.templates.ExecuteTemplate(r.writer, "codeblock", struct {
+		Id         string
+		Metadata   string
+		Attributes string
+		Code       []string
+	}{r.blockIds[node], node.Self.Values[0], node.Self.Values[2], code})
+
+	return r.writer.String()
+}
+
+// Math is converted to MathML on the server, unsupported TeX is displayed
+// as is along with the error
+func (r *Renderer) mathRenderer(node *lexer.Node, display bool) string {
+	math, err := mathml.Convert(node.Self.Values[0], display)
+	if err != nil {
+		r.templates.ExecuteTemplate(r.writer, "math-error", struct {
+			Id      string
+			Tex     string
+			Error   string
+			Display bool
+		}{r.blockIds[node], node.Self.Values[0], err.Error(), display})
+
+		return r.writer.String()
 	}
 
-	r.templates.ExecuteTemplate(r.writer, "callout", struct {
-		Values   template.HTML
-		Children template.HTML
-	}{template.HTML(values), template.HTML(children)})
+	r.templates.ExecuteTemplate(r.writer, "math", struct {
+		Id      string
+		Value   template.HTML
+		Display bool
+	}{r.blockIds[node], template.HTML(math), display})
 
 	return r.writer.String()
 }
 
-func (r *Renderer) codeBlockRenderer(node *lexer.Node) string {
-	code := strings.Split(node.Self.Values[1], "\n")
+func (r *Renderer) horizontalRuleRenderer() string {
+	r.templates.ExecuteTemplate(r.writer, "horizontal-rule", nil)
 
-	r.templates.ExecuteTemplate(r.writer, "codeblock", struct {
-		Metadata string
-		Code     []string
-	}{node.Self.Values[0], code})
+	return r.writer.String()
+}
+
+func (r *Renderer) tableRenderer(node *lexer.Node) string {
+	type Cell struct {
+		Align string
+		Value template.HTML
+	}
+
+	type Data struct {
+		Id     string
+		Header []Cell
+		Rows   [][]Cell
+	}
+
+	data := Data{Id: r.blockIds[node]}
+
+	for _, row := range node.Children {
+		cells := []Cell{}
+
+		for _, cell := range row.Children {
+			values, _ := r.Traverse(cell)
+			cells = append(cells, Cell{cell.Self.Values[0], template.HTML(values)})
+		}
+
+		if row.Self.Values[0] == "header" {
+			data.Header = cells
+		} else {
+			data.Rows = append(data.Rows, cells)
+		}
+	}
+
+	r.templates.ExecuteTemplate(r.writer, "table", data)
+
+	return r.writer.String()
+}
+
+func (r *Renderer) footnoteRefRenderer(node *lexer.Node) string {
+	r.templates.ExecuteTemplate(r.writer, "footnote-ref", struct {
+		Label      string
+		Number     string
+		Occurrence string
+	}{node.Self.Values[0], node.Self.Values[1], node.Self.Values[2]})
 
 	return r.writer.String()
 }
 
+func (r *Renderer) footnotesRenderer(node *lexer.Node) string {
+	type Footnote struct {
+		Label      string
+		Number     string
+		References []int
+		Values     template.HTML
+		Children   template.HTML
+	}
+
+	footnotes := []Footnote{}
+
+	for _, child := range node.Children {
+		values, children := r.Traverse(child)
+
+		total, _ := strconv.Atoi(child.Self.Values[2])
+		references := []int{}
+		for i := 1; i <= total; i++ {
+			references = append(references, i)
+		}
+
+		footnotes = append(footnotes, Footnote{
+			child.Self.Values[0],
+			child.Self.Values[1],
+			references,
+			template.HTML(values),
+			template.HTML(children),
+		})
+	}
+
+	// The part written before an error would leave the tags unclosed, so it is dropped
+	writer := &Writer{}
+	if err := r.templates.ExecuteTemplate(writer, "footnotes", footnotes); err != nil {
+		r.errs = append(r.errs, fmt.Errorf("Footnotes::error -> %w", err))
+		return ""
+	}
+
+	return writer.String()
+}
+
 func (r *Renderer) youtubePreview(urlStr string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
@@ -298,6 +565,11 @@ func (r *Renderer) githubPreview(urlStr string) (string, error) {
 
 	// NOTE: We can assume that the url has github.com domain name and can precisely trim the domain name
 	urlPath := strings.Split(urlStr[18:], "/")
+	// Autolinks can point to any github page, only repositories have a preview
+	if len(urlPath) < 3 || urlPath[1] == "" || urlPath[2] == "" {
+		return "", fmt.Errorf("Not a github repository url: %s\n", urlStr)
+	}
+
 	owner := urlPath[1]
 	repo := urlPath[2]
 
@@ -320,11 +592,13 @@ func (r *Renderer) githubPreview(urlStr string) (string, error) {
 		branches, err := apis.GetGithubBranches(ctx, owner, repo)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		commit, err := apis.GetGithubLatestCommit(ctx, owner, repo)
 		if err != nil {
 			respChan <- Response{error: err}
+			return
 		}
 
 		respChan <- Response{Data{Owner: owner, Repo: repo, Branches: branches, Commit: commit}, nil}
@@ -363,6 +637,90 @@ func (r *Renderer) githubPreview(urlStr string) (string, error) {
 	}
 }
 
+// Convert the image path written in the markdown file into the URL requested by
+// the browser. Relative paths are resolved by the server against the markdown
+// file's directory, the page is served at /<file>/ so the path stays relative
+func imageSource(src string) string {
+	imgUrl, err := url.Parse(src)
+	if err != nil || imgUrl.Scheme != "" || strings.HasPrefix(src, "/") {
+		return src
+	}
+
+	unescaped, err := url.PathUnescape(src)
+	if err != nil {
+		unescaped = src
+	}
+
+	// NOTE: Browsers and the server both drop parent segments from the path of the URL, so
+	// a path leaving the directory of the page is sent as a single segment with its slashes escaped
+	cleaned := path.Clean(unescaped)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return url.PathEscape(cleaned)
+	}
+
+	segments := strings.Split(cleaned, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func (r *Renderer) imageRenderer(node *lexer.Node) string {
+	r.templates.ExecuteTemplate(r.writer, "image", struct {
+		Alt   string
+		Src   string
+		Title string
+	}{node.Self.Values[0], imageSource(node.Self.Values[1]), node.Self.Values[2]})
+
+	return r.writer.String()
+}
+
+func (r *Renderer) wikilinkRenderer(node *lexer.Node) string {
+	note, heading, alias := node.Self.Values[0], node.Self.Values[1], node.Self.Values[2]
+
+	placeholder := alias
+	if placeholder == "" {
+		placeholder = note
+		if note != "" && heading != "" {
+			placeholder += " > "
+		}
+		placeholder += heading
+	}
+
+	link := ""
+	broken := false
+
+	// [[#Heading]] links to the current note
+	if note != "" {
+		var err error
+
+		if r.notes == nil {
+			err = fmt.Errorf("%w: [[%s]]", ErrNoteNotFound, note)
+		} else {
+			link, err = r.notes.Resolve(note)
+		}
+
+		if errors.Is(err, ErrNoteNotFound) {
+			broken = true
+		} else if err != nil {
+			r.errs = append(r.errs, err)
+		}
+	}
+
+	if heading != "" {
+		link += "#" + anchor(heading)
+	}
+
+	r.templates.ExecuteTemplate(r.writer, "wikilink", struct {
+		Link        string
+		Placeholder string
+		Broken      bool
+	}{link, placeholder, broken})
+
+	return r.writer.String()
+}
+
 // e.g. Youtube = bg image, Reddit = minimal widget + title + overview
 func (r *Renderer) linkRenderer(node *lexer.Node) string {
 	var linkType string
@@ -381,12 +739,24 @@ func (r *Renderer) linkRenderer(node *lexer.Node) string {
 		linkType = "Gopkg"
 	}
 
+	// The placeholder can contain nested inline elements
+	placeholder, _ := r.Traverse(node)
+	if placeholder == "" {
+		placeholder = template.HTMLEscapeString(node.Self.Values[0])
+	}
+
+	title := ""
+	if len(node.Self.Values) > 2 {
+		title = node.Self.Values[2]
+	}
+
 	r.templates.ExecuteTemplate(r.writer, "link", struct {
 		Link        string
 		Type        string
-		Placeholder string
+		Title       string
+		Placeholder template.HTML
 		Preview     template.HTML
-	}{node.Self.Values[1], linkType, node.Self.Values[0], template.HTML(preview)})
+	}{node.Self.Values[1], linkType, title, template.HTML(placeholder), template.HTML(preview)})
 
 	return r.writer.String()
 }
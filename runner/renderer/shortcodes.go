@@ -0,0 +1,328 @@
+package renderer
+
+import (
+	"github.com/leminhnguyenai/personal-blog/runner/lexer"
+)
+
+// Emoji by their GitHub shortcode, e.g. :rocket:. Only a selection of the commonly used
+// emoji is included, the other shortcodes are reported as unknown, add entries to use them
+var Emojis = map[string]string{
+	"smile":                      "\U0001F604",
+	"smiley":                     "\U0001F603",
+	"grinning":                   "\U0001F600",
+	"laughing":                   "\U0001F606",
+	"joy":                        "\U0001F602",
+	"rofl":                       "\U0001F923",
+	"wink":                       "\U0001F609",
+	"blush":                      "\U0001F60A",
+	"heart_eyes":                 "\U0001F60D",
+	"thinking":                   "\U0001F914",
+	"neutral_face":               "\U0001F610",
+	"sweat_smile":                "\U0001F605",
+	"sob":                        "\U0001F62D",
+	"cry":                        "\U0001F622",
+	"angry":                      "\U0001F620",
+	"rage":                       "\U0001F621",
+	"scream":                     "\U0001F631",
+	"sunglasses":                 "\U0001F60E",
+	"nerd_face":                  "\U0001F913",
+	"upside_down_face":           "\U0001F643",
+	"slightly_smiling_face":      "\U0001F642",
+	"confused":                   "\U0001F615",
+	"open_mouth":                 "\U0001F62E",
+	"sleeping":                   "\U0001F634",
+	"skull":                      "\U0001F480",
+	"ghost":                      "\U0001F47B",
+	"robot":                      "\U0001F916",
+	"alien":                      "\U0001F47D",
+	"poop":                       "\U0001F4A9",
+	"hankey":                     "\U0001F4A9",
+	"clown_face":                 "\U0001F921",
+	"+1":                         "\U0001F44D",
+	"thumbsup":                   "\U0001F44D",
+	"-1":                         "\U0001F44E",
+	"thumbsdown":                 "\U0001F44E",
+	"ok_hand":                    "\U0001F44C",
+	"clap":                       "\U0001F44F",
+	"wave":                       "\U0001F44B",
+	"pray":                       "\U0001F64F",
+	"muscle":                     "\U0001F4AA",
+	"raised_hands":               "\U0001F64C",
+	"handshake":                  "\U0001F91D",
+	"point_right":                "\U0001F449",
+	"point_left":                 "\U0001F448",
+	"point_up_2":                 "\U0001F446",
+	"point_down":                 "\U0001F447",
+	"writing_hand":               "\u270D\uFE0F",
+	"eyes":                       "\U0001F440",
+	"brain":                      "\U0001F9E0",
+	"heart":                      "\u2764\uFE0F",
+	"broken_heart":               "\U0001F494",
+	"sparkles":                   "\u2728",
+	"star":                       "\u2B50",
+	"star2":                      "\U0001F31F",
+	"fire":                       "\U0001F525",
+	"boom":                       "\U0001F4A5",
+	"zap":                        "\u26A1",
+	"tada":                       "\U0001F389",
+	"confetti_ball":              "\U0001F38A",
+	"gift":                       "\U0001F381",
+	"trophy":                     "\U0001F3C6",
+	"rocket":                     "\U0001F680",
+	"100":                        "\U0001F4AF",
+	"warning":                    "\u26A0\uFE0F",
+	"x":                          "\u274C",
+	"white_check_mark":           "\u2705",
+	"heavy_check_mark":           "\u2714\uFE0F",
+	"question":                   "\u2753",
+	"exclamation":                "\u2757",
+	"no_entry":                   "\u26D4",
+	"no_entry_sign":              "\U0001F6AB",
+	"construction":               "\U0001F6A7",
+	"rotating_light":             "\U0001F6A8",
+	"bulb":                       "\U0001F4A1",
+	"memo":                       "\U0001F4DD",
+	"pencil":                     "\U0001F4DD",
+	"pencil2":                    "\u270F\uFE0F",
+	"book":                       "\U0001F4D6",
+	"books":                      "\U0001F4DA",
+	"bookmark":                   "\U0001F516",
+	"link":                       "\U0001F517",
+	"paperclip":                  "\U0001F4CE",
+	"pushpin":                    "\U0001F4CC",
+	"calendar":                   "\U0001F4C6",
+	"date":                       "\U0001F4C5",
+	"hourglass":                  "\u231B",
+	"hourglass_flowing_sand":     "\u23F3",
+	"alarm_clock":                "\u23F0",
+	"lock":                       "\U0001F512",
+	"unlock":                     "\U0001F513",
+	"key":                        "\U0001F511",
+	"hammer":                     "\U0001F528",
+	"wrench":                     "\U0001F527",
+	"hammer_and_wrench":          "\U0001F6E0\uFE0F",
+	"gear":                       "\u2699\uFE0F",
+	"package":                    "\U0001F4E6",
+	"computer":                   "\U0001F4BB",
+	"desktop_computer":           "\U0001F5A5\uFE0F",
+	"keyboard":                   "\u2328\uFE0F",
+	"iphone":                     "\U0001F4F1",
+	"floppy_disk":                "\U0001F4BE",
+	"cd":                         "\U0001F4BF",
+	"chart_with_upwards_trend":   "\U0001F4C8",
+	"chart_with_downwards_trend": "\U0001F4C9",
+	"bar_chart":                  "\U0001F4CA",
+	"mag":                        "\U0001F50D",
+	"bell":                       "\U0001F514",
+	"mega":                       "\U0001F4E3",
+	"loudspeaker":                "\U0001F4E2",
+	"email":                      "\U0001F4E7",
+	"envelope":                   "\u2709\uFE0F",
+	"inbox_tray":                 "\U0001F4E5",
+	"outbox_tray":                "\U0001F4E4",
+	"file_folder":                "\U0001F4C1",
+	"open_file_folder":           "\U0001F4C2",
+	"page_facing_up":             "\U0001F4C4",
+	"clipboard":                  "\U0001F4CB",
+	"speech_balloon":             "\U0001F4AC",
+	"thought_balloon":            "\U0001F4AD",
+	"zzz":                        "\U0001F4A4",
+	"dash":                       "\U0001F4A8",
+	"bug":                        "\U0001F41B",
+	"beetle":                     "\U0001F41E",
+	"ant":                        "\U0001F41C",
+	"snake":                      "\U0001F40D",
+	"crab":                       "\U0001F980",
+	"whale":                      "\U0001F433",
+	"penguin":                    "\U0001F427",
+	"cat":                        "\U0001F431",
+	"dog":                        "\U0001F436",
+	"unicorn":                    "\U0001F984",
+	"coffee":                     "\u2615",
+	"beer":                       "\U0001F37A",
+	"pizza":                      "\U0001F355",
+	"cake":                       "\U0001F370",
+	"apple":                      "\U0001F34E",
+	"sunny":                      "\u2600\uFE0F",
+	"cloud":                      "\u2601\uFE0F",
+	"rainbow":                    "\U0001F308",
+	"snowflake":                  "\u2744\uFE0F",
+	"crescent_moon":              "\U0001F319",
+	"earth_americas":             "\U0001F30E",
+	"globe_with_meridians":       "\U0001F310",
+	"seedling":                   "\U0001F331",
+	"evergreen_tree":             "\U0001F332",
+	"four_leaf_clover":           "\U0001F340",
+	"arrow_right":                "\u27A1\uFE0F",
+	"arrow_left":                 "\u2B05\uFE0F",
+	"arrow_up":                   "\u2B06\uFE0F",
+	"arrow_down":                 "\u2B07\uFE0F",
+	"recycle":                    "\u267B\uFE0F",
+	"new":                        "\U0001F195",
+	"free":                       "\U0001F193",
+	"ok":                         "\U0001F197",
+	"sos":                        "\U0001F198",
+	"information_source":         "\u2139\uFE0F",
+	"copyright":                  "\u00A9\uFE0F",
+	"registered":                 "\u00AE\uFE0F",
+	"tm":                         "\u2122\uFE0F",
+	"checkered_flag":             "\U0001F3C1",
+	"triangular_flag_on_post":    "\U0001F6A9",
+	"dart":                       "\U0001F3AF",
+	"game_die":                   "\U0001F3B2",
+	"video_game":                 "\U0001F3AE",
+	"art":                        "\U0001F3A8",
+	"musical_note":               "\U0001F3B5",
+	"headphones":                 "\U0001F3A7",
+	"camera":                     "\U0001F4F7",
+	"movie_camera":               "\U0001F3A5",
+	"tv":                         "\U0001F4FA",
+	"moneybag":                   "\U0001F4B0",
+	"dollar":                     "\U0001F4B5",
+}
+
+// Nerd Font glyphs by their class name on https://www.nerdfonts.com/cheat-sheet, e.g. :nf-dev-go:.
+// The glyphs are rendered with SymbolsNerdFont, only a selection of the icons is included and the
+// other shortcodes are reported as unknown, add entries to use them
+var NerdFontIcons = map[string]string{
+	"nf-dev-git":                 "\uE702",
+	"nf-dev-github_alt":          "\uE708",
+	"nf-dev-github_badge":        "\uE709",
+	"nf-dev-mysql":               "\uE704",
+	"nf-dev-database":            "\uE706",
+	"nf-dev-windows":             "\uE70F",
+	"nf-dev-apple":               "\uE711",
+	"nf-dev-linux":               "\uE712",
+	"nf-dev-nodejs_small":        "\uE718",
+	"nf-dev-npm":                 "\uE71E",
+	"nf-dev-go":                  "\uE724",
+	"nf-dev-scala":               "\uE737",
+	"nf-dev-java":                "\uE738",
+	"nf-dev-ruby":                "\uE739",
+	"nf-dev-ubuntu":              "\uE73A",
+	"nf-dev-python":              "\uE73C",
+	"nf-dev-php":                 "\uE73D",
+	"nf-dev-markdown":            "\uE73E",
+	"nf-dev-html5":               "\uE736",
+	"nf-dev-css3":                "\uE749",
+	"nf-dev-javascript":          "\uE74E",
+	"nf-dev-swift":               "\uE755",
+	"nf-dev-clojure":             "\uE768",
+	"nf-dev-redis":               "\uE76D",
+	"nf-dev-postgresql":          "\uE76E",
+	"nf-dev-haskell":             "\uE777",
+	"nf-dev-gnu":                 "\uE779",
+	"nf-dev-debian":              "\uE77D",
+	"nf-dev-terminal":            "\uE795",
+	"nf-dev-dart":                "\uE798",
+	"nf-dev-rust":                "\uE7A8",
+	"nf-dev-docker":              "\uE7B0",
+	"nf-dev-react":               "\uE7BA",
+	"nf-dev-vim":                 "\uE7C5",
+	"nf-seti-markdown":           "\uE609",
+	"nf-seti-json":               "\uE60B",
+	"nf-seti-config":             "\uE615",
+	"nf-seti-cpp":                "\uE61D",
+	"nf-seti-c":                  "\uE61E",
+	"nf-seti-lua":                "\uE620",
+	"nf-seti-go":                 "\uE627",
+	"nf-seti-typescript":         "\uE628",
+	"nf-seti-yml":                "\uE6A8",
+	"nf-fa-search":               "\uF002",
+	"nf-fa-heart":                "\uF004",
+	"nf-fa-star":                 "\uF005",
+	"nf-fa-user":                 "\uF007",
+	"nf-fa-check":                "\uF00C",
+	"nf-fa-close":                "\uF00D",
+	"nf-fa-cog":                  "\uF013",
+	"nf-fa-home":                 "\uF015",
+	"nf-fa-clock_o":              "\uF017",
+	"nf-fa-download":             "\uF019",
+	"nf-fa-tag":                  "\uF02B",
+	"nf-fa-tags":                 "\uF02C",
+	"nf-fa-book":                 "\uF02D",
+	"nf-fa-question_circle":      "\uF059",
+	"nf-fa-info_circle":          "\uF05A",
+	"nf-fa-warning":              "\uF071",
+	"nf-fa-calendar":             "\uF073",
+	"nf-fa-folder":               "\uF07B",
+	"nf-fa-folder_open":          "\uF07C",
+	"nf-fa-external_link":        "\uF08E",
+	"nf-fa-twitter":              "\uF099",
+	"nf-fa-github":               "\uF09B",
+	"nf-fa-rss":                  "\uF09E",
+	"nf-fa-link":                 "\uF0C1",
+	"nf-fa-copy":                 "\uF0C5",
+	"nf-fa-envelope":             "\uF0E0",
+	"nf-fa-linkedin":             "\uF0E1",
+	"nf-fa-lightbulb_o":          "\uF0EB",
+	"nf-fa-coffee":               "\uF0F4",
+	"nf-fa-terminal":             "\uF120",
+	"nf-fa-code":                 "\uF121",
+	"nf-fa-file":                 "\uF15B",
+	"nf-fa-youtube_play":         "\uF16A",
+	"nf-fa-bug":                  "\uF188",
+	"nf-oct-repo":                "\uF401",
+	"nf-oct-book":                "\uF405",
+	"nf-oct-git_pull_request":    "\uF407",
+	"nf-oct-mark_github":         "\uF408",
+	"nf-oct-git_commit":          "\uF417",
+	"nf-oct-git_branch":          "\uF418",
+	"nf-oct-issue_opened":        "\uF41B",
+	"nf-md-alert":                "\U000F0026",
+	"nf-md-bug":                  "\U000F00E4",
+	"nf-md-calendar":             "\U000F00ED",
+	"nf-md-check":                "\U000F012C",
+	"nf-md-clipboard_text":       "\U000F0147",
+	"nf-md-clock_outline":        "\U000F0150",
+	"nf-md-close":                "\U000F0156",
+	"nf-md-coffee":               "\U000F0176",
+	"nf-md-console":              "\U000F018D",
+	"nf-md-database":             "\U000F01BC",
+	"nf-md-email":                "\U000F01EE",
+	"nf-md-file":                 "\U000F0214",
+	"nf-md-fire":                 "\U000F0238",
+	"nf-md-folder":               "\U000F024B",
+	"nf-md-format_list_bulleted": "\U000F0279",
+	"nf-md-format_quote_close":   "\U000F027E",
+	"nf-md-git":                  "\U000F02A2",
+	"nf-md-github":               "\U000F02A4",
+	"nf-md-heart":                "\U000F02D1",
+	"nf-md-help_circle":          "\U000F02D7",
+	"nf-md-home":                 "\U000F02DC",
+	"nf-md-information":          "\U000F02FC",
+	"nf-md-language_css3":        "\U000F031C",
+	"nf-md-language_html5":       "\U000F031D",
+	"nf-md-language_javascript":  "\U000F031E",
+	"nf-md-language_python":      "\U000F0320",
+	"nf-md-linux":                "\U000F033D",
+	"nf-md-pencil":               "\U000F03EB",
+	"nf-md-star":                 "\U000F04CE",
+	"nf-md-check_circle_outline": "\U000F05E1",
+	"nf-md-language_c":           "\U000F0671",
+	"nf-md-language_cpp":         "\U000F0672",
+	"nf-md-language_typescript":  "\U000F06E6",
+	"nf-md-language_go":          "\U000F07D3",
+	"nf-md-docker":               "\U000F0868",
+	"nf-md-language_lua":         "\U000F08B1",
+	"nf-md-lightning_bolt":       "\U000F140B",
+	"nf-md-rocket_launch":        "\U000F14DE",
+	"nf-md-language_rust":        "\U000F1617",
+}
+
+// Render emoji as text and Nerd Font glyphs with the icon font, unknown shortcodes
+// are kept as they were written and reported as warnings
+func (r *Renderer) shortcodeRenderer(node *lexer.Node) string {
+	name := node.Self.Values[0]
+
+	if emoji, ok := Emojis[name]; ok {
+		r.templates.ExecuteTemplate(r.writer, "text", struct{ Value string }{emoji})
+	} else if glyph, ok := NerdFontIcons[name]; ok {
+		r.templates.ExecuteTemplate(r.writer, "nerd-font-icon", struct{ Value string }{glyph})
+	} else {
+		r.warn(node, "unknown shortcode :%s:, rendered as text", name)
+		r.templates.ExecuteTemplate(r.writer, "text", struct{ Value string }{":" + name + ":"})
+	}
+
+	return r.writer.String()
+}
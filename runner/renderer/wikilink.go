@@ -0,0 +1,102 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNoteNotFound  = errors.New("note not found")
+	ErrAmbiguousNote = errors.New("ambiguous note")
+)
+
+type note struct {
+	file string
+	url  string
+}
+
+// Map the note names used by wiki links and embeds to the notes' files and URLs
+type NoteResolver struct {
+	rootDir string
+	// Lowercase note name -> notes with that name
+	names map[string][]note
+	// Lowercase path relative to the content directory -> note
+	paths map[string]note
+}
+
+func NewNoteResolver(rootDir string) *NoteResolver {
+	return &NoteResolver{
+		rootDir: rootDir,
+		names:   map[string][]note{},
+		paths:   map[string]note{},
+	}
+}
+
+func normalizeNoteName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), ".md"))
+}
+
+// Register a note, relPath is the path of the file relative to the content directory
+func (resolver *NoteResolver) Add(relPath string, url string) {
+	notePath := normalizeNoteName(path.Clean(relPath))
+	name := path.Base(notePath)
+	entry := note{filepath.Join(resolver.rootDir, filepath.FromSlash(relPath)), url}
+
+	resolver.names[name] = append(resolver.names[name], entry)
+	resolver.paths[notePath] = entry
+}
+
+func (resolver *NoteResolver) lookup(name string) (note, error) {
+	target := normalizeNoteName(name)
+
+	candidates := []note{}
+
+	if strings.Contains(target, "/") {
+		target = strings.TrimPrefix(path.Clean(target), "/")
+
+		for notePath, entry := range resolver.paths {
+			if notePath == target || strings.HasSuffix(notePath, "/"+target) {
+				candidates = append(candidates, entry)
+			}
+		}
+
+		slices.SortFunc(candidates, func(a, b note) int { return strings.Compare(a.url, b.url) })
+	} else {
+		candidates = resolver.names[target]
+	}
+
+	switch len(candidates) {
+	case 0:
+		return note{}, fmt.Errorf("%w: [[%s]]", ErrNoteNotFound, name)
+	case 1:
+		return candidates[0], nil
+	default:
+		urls := []string{}
+		for _, candidate := range candidates {
+			urls = append(urls, candidate.url)
+		}
+
+		return candidates[0], fmt.Errorf(
+			"%w: [[%s]] matches %s, use the path of the note instead",
+			ErrAmbiguousNote, name, strings.Join(urls, ", "),
+		)
+	}
+}
+
+// Resolve the note to its URL, the note can be a name or a path, e.g. folder/note
+func (resolver *NoteResolver) Resolve(name string) (string, error) {
+	entry, err := resolver.lookup(name)
+
+	return entry.url, err
+}
+
+// Resolve the note to the path of its markdown file
+func (resolver *NoteResolver) ResolveFile(name string) (string, error) {
+	entry, err := resolver.lookup(name)
+
+	return entry.file, err
+}
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -85,6 +87,53 @@ func sanitizeFilename(filepath string) (string, error) {
 	return strings.ToLower(sanitizedFilename), nil
 }
 
+// Find the notes in the directory and generate the URL of each one, the notes are registered
+// to the resolver used by wiki links and embeds
+func registerNotes(dirPath string) ([]string, map[string]string, *renderer.NoteResolver, error) {
+	mdFiles, err := searchMdFiles(dirPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Keep the URLs of notes sharing the same name stable between runs
+	slices.Sort(mdFiles)
+
+	fileUrls := map[string]string{}
+	takenUrls := map[string]bool{}
+	notes := renderer.NewNoteResolver(dirPath)
+
+	// Generate path for each file
+	for _, file := range mdFiles {
+		fileUrl, err := sanitizeFilename(path.Base(file))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		relPath, err := filepath.Rel(dirPath, file)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// Notes with the same name in different folders are told apart by their folders
+		if takenUrls[fileUrl] {
+			fileUrl, err = sanitizeFilename(strings.ReplaceAll(filepath.ToSlash(relPath), "/", " "))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		if takenUrls[fileUrl] {
+			return nil, nil, nil, fmt.Errorf("Duplicate URL /%s for %s\n", fileUrl, file)
+		}
+
+		takenUrls[fileUrl] = true
+		fileUrls[file] = fileUrl
+		notes.Add(filepath.ToSlash(relPath), "/"+fileUrl)
+	}
+
+	return mdFiles, fileUrls, notes, nil
+}
+
 func Server(e *Engine, dirPath string) error {
 	hash := int(time.Now().Unix())
 
@@ -92,7 +141,7 @@ func Server(e *Engine, dirPath string) error {
 
 	mux.Handle("GET /static/", FileServer("static"))
 
-	mdFiles, err := searchMdFiles(dirPath)
+	mdFiles, fileUrls, notes, err := registerNotes(dirPath)
 	if err != nil {
 		return err
 	}
@@ -104,17 +153,16 @@ func Server(e *Engine, dirPath string) error {
 
 	var blogs []Blog
 
-	// Generate path for each file
 	for _, file := range mdFiles {
-		fileUrl, err := sanitizeFilename(path.Base(file))
-		if err != nil {
-			return err
-		}
-		url := fmt.Sprintf("GET /%s/", fileUrl)
+		fileUrl := fileUrls[file]
+		url := fmt.Sprintf("GET /%s/{$}", fileUrl)
 		e.debug("%s\n", fileUrl)
 
 		blogs = append(blogs, Blog{"/" + fileUrl, path.Base(file)})
 
+		// Images are referenced relative to the page
+		mux.Handle(fmt.Sprintf("GET /%s/{asset...}", fileUrl), AssetServer(dirPath, path.Dir(file)))
+
 		mux.Handle(
 			url,
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,8 +175,7 @@ func Server(e *Engine, dirPath string) error {
 				}
 
 				astTree, err := lexer.ParseAST(string(data))
-				if err != nil {
-					HandleError(w, err)
+				if !e.handleDiagnostics(w, file, err) {
 					return
 				}
 
@@ -137,10 +184,18 @@ func Server(e *Engine, dirPath string) error {
 					HandleError(w, err)
 					return
 				}
+				mdRenderer.SetNoteResolver(notes)
+				mdRenderer.SetCurrentNote(file)
 				writer := &renderer.Writer{}
 
 				content := mdRenderer.Render(astTree)
 
+				if !e.handleRenderErrors(w, file, mdRenderer.Errors()) {
+					return
+				}
+
+				e.handleDiagnostics(w, file, mdRenderer.Warnings())
+
 				templ, err := template.New("").
 					Funcs(renderer.FuncsMap).
 					ParseFiles("templates/index.html", "templates/templates.html")